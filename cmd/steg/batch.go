@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pableeee/steg/steg"
+	"github.com/spf13/cobra"
+)
+
+var batchFlags = struct {
+	manifest,
+	dir,
+	inputMessage,
+	outputDir,
+	report,
+	key string
+	workers int
+}{}
+
+var (
+	batchCmd = &cobra.Command{
+		Use:   "batch",
+		Short: "Encode or decode many images concurrently",
+		Long: `Processes a list of images with a bounded worker pool. Items come either
+from a manifest (--manifest) or from every PNG, BMP and TIFF file in a
+directory (--dir).
+
+A manifest is a CSV file with a header row naming the columns carrier,
+message and output, or a JSON array of objects with those keys. For decode
+the message column is ignored: carrier is the stego image and output is the
+file the recovered payload is written to.
+
+Every item is attempted; failures are reported per item and do not stop the
+batch. The command exits non-zero if any item failed.`,
+	}
+
+	batchEncodeCmd = &cobra.Command{
+		Use:   "encode",
+		Short: "Encode a message into many carrier images",
+		Long: `Encodes into every carrier listed in --manifest, or into every image in --dir.
+In directory mode the message given with --input_file is embedded into each
+carrier and results are written to --output_dir under the carrier's name.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBatch(cmd.Context(), true)
+		},
+	}
+
+	batchDecodeCmd = &cobra.Command{
+		Use:   "decode",
+		Short: "Decode the messages embedded in many images",
+		Long: `Decodes every image listed in --manifest, or every image in --dir.
+In directory mode each payload is written to --output_dir as <name>.bin.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBatch(cmd.Context(), false)
+		},
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{batchEncodeCmd, batchDecodeCmd} {
+		c.Flags().StringVarP(&batchFlags.manifest, "manifest", "m", "", "CSV or JSON manifest of carrier, message, output.")
+		c.Flags().StringVarP(&batchFlags.dir, "dir", "d", "", "Directory of images to process instead of a manifest.")
+		c.Flags().StringVarP(&batchFlags.outputDir, "output_dir", "o", "", "Directory for outputs in --dir mode.")
+		c.Flags().StringVarP(&batchFlags.key, "password", "p", "", "passphrase shared by every item.")
+		c.Flags().StringVar(&batchFlags.report, "report", "", "Write a JSON report of every item to this path.")
+		c.Flags().IntVarP(&batchFlags.workers, "workers", "w", 0, "number of images processed concurrently (0 = number of CPUs)")
+		c.Flags().IntVarP(&bitsPerChannel, "bits-per-channel", "b", 1, "number of LSBs to use per color channel (1-8)")
+		c.Flags().IntVarP(&channels, "channels", "c", 3, "number of color channels to use: 1=R, 2=R+G, 3=R+G+B")
+		c.Flags().StringVar(&traversal, "traversal", "fisher-yates", "pixel order: fisher-yates, feistel (constant memory) or chacha8 (Argon2id-keyed); decode with the encode setting")
+		c.Flags().BoolVar(&permuteSlots, "permute-slots", false, "fill the bit slots of each pixel in a password-keyed order; decode with the encode setting")
+		c.Flags().BoolVar(&randomAccess, "random-access", false, "tag every 4 KiB of payload so it can be read at random; decode with the encode setting")
+		c.MarkFlagRequired("password")
+		batchCmd.AddCommand(c)
+	}
+	batchEncodeCmd.Flags().StringVarP(
+		&batchFlags.inputMessage, "input_file", "f", "", "Message embedded into every carrier in --dir mode.",
+	)
+}
+
+// batchItem is one unit of work, as listed in a manifest.
+type batchItem struct {
+	Carrier string `json:"carrier"`
+	Message string `json:"message,omitempty"`
+	Output  string `json:"output"`
+}
+
+// batchResult is the outcome of processing a batchItem.
+type batchResult struct {
+	batchItem
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	Bytes      int    `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func runBatch(ctx context.Context, encode bool) error {
+	if err := validateEncodingFlags(); err != nil {
+		return err
+	}
+
+	items, err := batchItems(encode)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no items to process")
+	}
+
+	// Images are processed concurrently, so each runs on a single worker.
+	opts := encodingOptions(steg.WithWorkers(1))
+	enc, err := steg.NewEncoder(opts...)
+	if err != nil {
+		return err
+	}
+	dec, err := steg.NewDecoder(opts...)
+	if err != nil {
+		return err
+	}
+	pass := []byte(batchFlags.key)
+
+	results := runPool(batchFlags.workers, items, func(it batchItem) batchResult {
+		start := time.Now()
+		var n int
+		var err error
+		if encode {
+			n, err = batchEncodeItem(ctx, it, pass, enc)
+		} else {
+			n, err = batchDecodeItem(ctx, it, pass, dec)
+		}
+		res := batchResult{batchItem: it, OK: err == nil, Bytes: n, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		return res
+	})
+
+	failed := 0
+	for _, r := range results {
+		if r.OK {
+			fmt.Printf("  OK    %s → %s  (%s, %d ms)\n", r.Carrier, r.Output, humanBytes(r.Bytes), r.DurationMS)
+		} else {
+			failed++
+			fmt.Printf("  FAIL  %s: %s\n", r.Carrier, r.Error)
+		}
+	}
+	fmt.Printf("\nDone. %d succeeded, %d failed.\n", len(results)-failed, failed)
+
+	if batchFlags.report != "" {
+		if err = writeBatchReport(batchFlags.report, results); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d items failed", failed, len(results))
+	}
+	return nil
+}
+
+func batchEncodeItem(ctx context.Context, it batchItem, pass []byte, enc *steg.Encoder) (int, error) {
+	src, err := decodeImage(it.Carrier)
+	if err != nil {
+		return 0, err
+	}
+	msg, err := os.ReadFile(it.Message)
+	if err != nil {
+		return 0, err
+	}
+	cimg := toDrawImage(src)
+	if err = enc.Encode(ctx, cimg, pass, bytes.NewReader(msg)); err != nil {
+		return 0, err
+	}
+	if err = encodeImage(it.Output, cimg); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+func batchDecodeItem(ctx context.Context, it batchItem, pass []byte, dec *steg.Decoder) (int, error) {
+	src, err := decodeImage(it.Carrier)
+	if err != nil {
+		return 0, err
+	}
+	b, err := dec.Decode(ctx, toDrawImage(src), pass)
+	if err != nil {
+		return 0, err
+	}
+	if err = os.WriteFile(it.Output, b, 0644); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// batchItems builds the work list from --manifest or --dir.
+func batchItems(encode bool) ([]batchItem, error) {
+	switch {
+	case batchFlags.manifest != "" && batchFlags.dir != "":
+		return nil, fmt.Errorf("--manifest and --dir are mutually exclusive")
+	case batchFlags.manifest != "":
+		return readManifest(batchFlags.manifest, encode)
+	case batchFlags.dir != "":
+		return dirItems(batchFlags.dir, encode)
+	default:
+		return nil, fmt.Errorf("one of --manifest or --dir is required")
+	}
+}
+
+// readManifest parses a JSON manifest (by .json extension) or a CSV manifest.
+func readManifest(path string, encode bool) ([]batchItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []batchItem
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		if err = json.NewDecoder(bufio.NewReader(f)).Decode(&items); err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", path, err)
+		}
+	} else if items, err = readCSVManifest(f); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+
+	for i, it := range items {
+		if it.Carrier == "" || it.Output == "" || (encode && it.Message == "") {
+			return nil, fmt.Errorf("manifest %s: entry %d is missing a required field", path, i+1)
+		}
+	}
+	return items, nil
+}
+
+// readCSVManifest reads rows keyed by a header naming carrier, message and
+// output in any order. The message column may be omitted for decode.
+func readCSVManifest(r io.Reader) ([]batchItem, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	col := map[string]int{}
+	for i, name := range rows[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"carrier", "output"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("header is missing the %q column", name)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	items := make([]batchItem, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		items = append(items, batchItem{
+			Carrier: field(row, "carrier"),
+			Message: field(row, "message"),
+			Output:  field(row, "output"),
+		})
+	}
+	return items, nil
+}
+
+// dirItems lists every supported image in dir. Encode outputs keep the
+// carrier's file name; decode outputs are named <name>.bin.
+func dirItems(dir string, encode bool) ([]batchItem, error) {
+	if batchFlags.outputDir == "" {
+		return nil, fmt.Errorf("--output_dir is required with --dir")
+	}
+	if encode && batchFlags.inputMessage == "" {
+		return nil, fmt.Errorf("--input_file is required with --dir")
+	}
+	if err := os.MkdirAll(batchFlags.outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create output directory: %w", err)
+	}
+	// Outputs keep the carriers' names, so writing them into dir would
+	// overwrite the carriers.
+	same, err := sameDir(dir, batchFlags.outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if same {
+		return nil, fmt.Errorf("--output_dir must not be the --dir directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var items []batchItem
+	for _, e := range entries {
+		if e.IsDir() || !isSupportedImage(e.Name()) {
+			continue
+		}
+		it := batchItem{Carrier: filepath.Join(dir, e.Name())}
+		if encode {
+			it.Message = batchFlags.inputMessage
+			it.Output = filepath.Join(batchFlags.outputDir, e.Name())
+		} else {
+			base := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+			it.Output = filepath.Join(batchFlags.outputDir, base+".bin")
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// sameDir reports whether a and b name the same directory, following
+// symbolic links.
+func sameDir(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ai, bi), nil
+}
+
+func writeBatchReport(path string, results []batchResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create report file: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var compareFlags = struct {
+	cover,
+	stego string
+	minPSNR,
+	minSSIM,
+	maxChanged float64
+}{}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Measure the distortion between a cover image and its stego version",
+	Long: `Computes per-channel MSE, PSNR and SSIM, the number and percentage of
+changed pixels, the largest absolute change and a histogram of changes.
+
+Quality gates (--min-psnr, --min-ssim, --max-changed) make the command exit
+non-zero when the stego image is more distorted than allowed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// A failed quality gate is a verdict, not a usage mistake.
+		cmd.SilenceUsage = true
+		return runCompare()
+	},
+}
+
+func init() {
+	compareCmd.Flags().StringVar(&compareFlags.cover, "cover", "", "Original carrier image (PNG, BMP, TIFF).")
+	compareCmd.Flags().StringVar(&compareFlags.stego, "stego", "", "Image produced by encode.")
+	compareCmd.Flags().Float64Var(&compareFlags.minPSNR, "min-psnr", 0, "fail if the overall PSNR is below this many dB")
+	compareCmd.Flags().Float64Var(&compareFlags.minSSIM, "min-ssim", 0, "fail if the mean SSIM is below this value")
+	compareCmd.Flags().Float64Var(&compareFlags.maxChanged, "max-changed", 100, "fail if more than this percentage of pixels changed")
+	compareCmd.MarkFlagRequired("cover")
+	compareCmd.MarkFlagRequired("stego")
+}
+
+func runCompare() error {
+	cover, err := decodeImage(compareFlags.cover)
+	if err != nil {
+		return err
+	}
+	stego, err := decodeImage(compareFlags.stego)
+	if err != nil {
+		return err
+	}
+
+	res, err := analysis.Compare(cover, stego)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d × %d px\n\n", res.Width, res.Height)
+	fmt.Printf("  %-4s %12s %12s %10s %10s %7s\n", "", "MSE", "PSNR", "SSIM", "Changed", "Max Δ")
+	for _, c := range res.Channels {
+		pct := 100 * float64(c.Changed) / float64(res.Width*res.Height)
+		fmt.Printf("  %-4s %12.6f %12s %10.6f %9.2f%% %7d\n", c.Channel, c.MSE, formatPSNR(c.PSNR), c.SSIM, pct, c.MaxAbsDelta)
+	}
+	fmt.Printf("  %-4s %12.6f %12s %10.6f %9.2f%% %7d\n", "All", res.MSE, formatPSNR(res.PSNR), res.SSIM, res.ChangedPercent, res.MaxAbsDelta)
+
+	fmt.Printf("\nChanged pixels: %s of %s (%.2f%%)\n",
+		formatBytes(res.ChangedPixels), formatBytes(res.Width*res.Height), res.ChangedPercent)
+	fmt.Println("\nDelta histogram (stego − cover: pixels):")
+	for _, c := range res.Channels {
+		fmt.Printf("  %s: %s\n", c.Channel, formatDeltaHist(c.DeltaHist))
+	}
+
+	var failures []string
+	if res.PSNR < compareFlags.minPSNR {
+		failures = append(failures, fmt.Sprintf("PSNR %s < %.2f dB", formatPSNR(res.PSNR), compareFlags.minPSNR))
+	}
+	if res.SSIM < compareFlags.minSSIM {
+		failures = append(failures, fmt.Sprintf("SSIM %.6f < %.6f", res.SSIM, compareFlags.minSSIM))
+	}
+	if res.ChangedPercent > compareFlags.maxChanged {
+		failures = append(failures, fmt.Sprintf("changed pixels %.2f%% > %.2f%%", res.ChangedPercent, compareFlags.maxChanged))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("quality gate failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// formatPSNR renders a PSNR value in dB, or "∞" for identical images.
+func formatPSNR(v float64) string {
+	if math.IsInf(v, 1) {
+		return "∞"
+	}
+	return fmt.Sprintf("%.2f dB", v)
+}
+
+// formatDeltaHist renders a delta histogram in ascending delta order.
+func formatDeltaHist(hist map[int]int) string {
+	deltas := make([]int, 0, len(hist))
+	for d := range hist {
+		deltas = append(deltas, d)
+	}
+	sort.Ints(deltas)
+	parts := make([]string, len(deltas))
+	for i, d := range deltas {
+		parts[i] = fmt.Sprintf("%+d: %s", d, formatBytes(hist[d]))
+	}
+	return strings.Join(parts, "  ")
+}
@@ -1,18 +1,38 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"image"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/pableeee/steg/steg/analysis"
 	"github.com/spf13/cobra"
 )
 
-var detectFlags = struct{ inputImage string }{}
+var detectFlags = struct {
+	inputImage,
+	heatmap,
+	heatmapTest,
+	format,
+	recursive,
+	report,
+	detectors,
+	combine,
+	weights,
+	model string
+	tileSize,
+	tileStride,
+	planes,
+	workers int
+}{}
 
 var detectCmd = &cobra.Command{
 	Use:   "detect",
 	Short: "Run steganalysis on an image to detect possible LSB steganography",
-	Long: `Runs two complementary statistical tests on the image:
+	Long: `Runs four complementary statistical tests on the image:
 
   Chi-square  Detects global LSB histogram uniformity. Natural images have
               unequal (2k)/(2k+1) pixel-value pair frequencies; LSB embedding
@@ -20,9 +40,76 @@ var detectCmd = &cobra.Command{
 
   RS analysis Detects local pixel smoothness asymmetry. LSB embedding biases
               the response to the positive flipping mask (Rm) over the negative
-              (Rnm). A positive asymmetry (Rm − Rnm > 0.01) is suspicious.`,
+              (Rnm). A positive asymmetry (Rm − Rnm > 0.01) is suspicious.
+              Horizontal, vertical and 2×2 masks also yield an estimated
+              embedding rate, with a confidence reflecting their agreement.
+
+  SPA         Sample Pairs Analysis estimates the fraction of samples in each
+              channel that carry embedded bits, from 0 (clean) to 1 (every
+              sample used). An estimate above 0.05 is suspicious. It does
+              not change the default verdict; select it with --detectors to
+              let it vote.
+
+  WS          Weighted-stego analysis estimates the same rate by predicting
+              each pixel from its neighbours. An estimate above 0.05 is
+              suspicious. Like SPA it does not change the default verdict.
+
+Each test runs on every channel of the image at its stored depth: R, G and B
+for colour images, a single Y channel for grayscale ones (including colour
+files whose channels are all equal), and A as well when some pixel is not
+fully opaque. 16-bit images are analysed on their full 16-bit samples, so
+embedding in the low byte is not missed.
+
+Bit planes 0 to N − 1 of each channel, N = --planes (4 by default), are also
+tested one at a time: chi-square and RS on pairs that differ in that bit, plus
+SPA and WS with the lower planes discarded. A plane whose mean RS/SPA/WS rate
+exceeds 0.2 is counted as used, and the highest used plane gives the estimated
+number of LSB planes (bits per channel) carrying data. This is reported
+alongside the tests above and does not change the verdict. --planes 8 reaches
+the top plane of 8-bit images; --planes 0 skips the analysis.
+
+With --heatmap, chi-square or RS is also run on square tiles of the image and
+the per-tile scores are rendered over a grayscale copy, from green (clean) to
+red (suspicious). This locates embedding confined to part of a large image,
+which the whole-image tests dilute.
+
+--format json or csv prints the same statistics in machine-readable form.
+
+--detectors runs only the named detectors (see the flag help for the list) and
+reports each one as a per-channel score and confidence. --combine chooses how
+their results become a verdict:
+  all       CLEAN if no channel is flagged, LIKELY_STEGO if every channel of
+            every detector is, SUSPICIOUS otherwise (the default)
+  any       LIKELY_STEGO as soon as one detector flags a channel
+  majority  LIKELY_STEGO when more than half of the detectors flag a channel
+  weighted  average of each flagging detector's confidence, weighted by
+            --weights; LIKELY_STEGO at 0.5 or more
+
+--model applies a classifier trained with steg train. On its own it is the only
+detector run; combine it with --detectors to run built-in tests alongside it.
+Its score is the probability-like output of the model, above 0.5 meaning
+stego.
+
+With --recursive, every PNG, BMP and TIFF under a directory is analysed
+concurrently and a summary of all files is printed, most suspicious first.
+Files that cannot be read are listed as ERROR rather than stopping the scan.
+
+Exit status:
+  0  CLEAN
+  1  error (unreadable image, bad flags, ...)
+  4  SUSPICIOUS
+  5  LIKELY_STEGO
+With --recursive the status is that of the most suspicious file; it is 1 only
+if some files could not be read and none were flagged.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runDetect()
+		err := runDetect()
+		var ee *exitError
+		if errors.As(err, &ee) {
+			// A verdict is reported through the exit status alone.
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+		}
+		return err
 	},
 }
 
@@ -30,17 +117,204 @@ func init() {
 	detectCmd.Flags().StringVarP(
 		&detectFlags.inputImage, "input_image", "i", "", "Image to analyse (PNG, BMP, TIFF).",
 	)
-	detectCmd.MarkFlagRequired("input_image")
+	detectCmd.Flags().StringVarP(&detectFlags.recursive, "recursive", "r", "", "Analyse every image under this directory instead of --input_image.")
+	detectCmd.Flags().IntVarP(&detectFlags.workers, "workers", "w", 0, "number of images analysed concurrently with --recursive (0 = number of CPUs)")
+	detectCmd.Flags().StringVar(&detectFlags.report, "report", "", "With --recursive, write the summary to this path instead of stdout.")
+	detectCmd.Flags().StringVar(&detectFlags.format, "format", "text", "output format: text, json or csv")
+	detectCmd.Flags().StringVar(
+		&detectFlags.detectors, "detectors", "",
+		"comma-separated detectors to run: "+strings.Join(analysis.RegisteredDetectors(), ", ")+" (default all built-in tests)",
+	)
+	detectCmd.Flags().StringVar(&detectFlags.combine, "combine", "all", "how detector results become a verdict: all, any, majority or weighted")
+	detectCmd.Flags().StringVar(&detectFlags.weights, "weights", "", "detector weights for --combine weighted, e.g. rs=2,spa=1 (default 1 each)")
+	detectCmd.Flags().StringVar(&detectFlags.model, "model", "", "Apply a model file written by steg train as an extra detector.")
+	detectCmd.Flags().IntVar(&detectFlags.planes, "planes", 4, "number of bit planes to analyse per channel, from the LSB up; at most 8 apply to 8-bit images (0 = skip, max 16)")
+	detectCmd.Flags().StringVar(&detectFlags.heatmap, "heatmap", "", "Write a per-tile heatmap to this path (PNG, BMP, TIFF).")
+	detectCmd.Flags().StringVar(&detectFlags.heatmapTest, "heatmap-test", "chi-square", "test for the heatmap: chi-square or rs")
+	detectCmd.Flags().IntVar(&detectFlags.tileSize, "tile", 64, "heatmap tile size in pixels")
+	detectCmd.Flags().IntVar(&detectFlags.tileStride, "stride", 0, "distance between heatmap tiles; 0 = tile size (disjoint tiles)")
+	detectCmd.MarkFlagsOneRequired("input_image", "recursive")
+	detectCmd.MarkFlagsMutuallyExclusive("input_image", "recursive")
+}
+
+// heatmapSummary describes a heatmap written by --heatmap.
+type heatmapSummary struct {
+	Path       string `json:"path"`
+	Test       string `json:"test"`
+	Tile       int    `json:"tile"`
+	Tiles      int    `json:"tiles"`
+	Suspicious int    `json:"suspicious"`
+}
+
+// detectReport is the machine-readable form of one detect run.
+type detectReport struct {
+	Image string `json:"image"`
+	analysis.Result
+	Detectors []analysis.DetectorResult  `json:"detectors,omitempty"` // set when --detectors or --combine is used
+	BitPlanes []analysis.BitPlaneChannel `json:"bit_planes,omitempty"`
+	Heatmap   *heatmapSummary            `json:"heatmap,omitempty"`
+	Error     string                     `json:"error,omitempty"` // set when the image could not be analysed
+}
+
+// detectorSelection holds the detectors and combiner chosen with --detectors,
+// --model, --combine and --weights. A nil selection means the default full analysis.
+type detectorSelection struct {
+	detectors []analysis.Detector
+	combiner  analysis.Combiner
+}
+
+func parseDetectorSelection() (*detectorSelection, error) {
+	if detectFlags.detectors == "" && detectFlags.model == "" && detectFlags.combine == "all" && detectFlags.weights == "" {
+		return nil, nil
+	}
+
+	var names []string
+	if detectFlags.detectors != "" {
+		names = strings.Split(detectFlags.detectors, ",")
+	} else if detectFlags.model == "" {
+		names = []string{"chi-square", "rs", "spa", "ws"}
+	}
+	sel := &detectorSelection{}
+	for _, name := range names {
+		d, err := analysis.Lookup(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		sel.detectors = append(sel.detectors, d)
+	}
+	if detectFlags.model != "" {
+		m, err := loadModel(detectFlags.model)
+		if err != nil {
+			return nil, err
+		}
+		sel.detectors = append(sel.detectors, m)
+	}
+
+	if detectFlags.weights != "" && detectFlags.combine != "weighted" {
+		return nil, fmt.Errorf("--weights requires --combine weighted")
+	}
+	switch detectFlags.combine {
+	case "all":
+		sel.combiner = analysis.CombineAll
+	case "any":
+		sel.combiner = analysis.CombineAny
+	case "majority":
+		sel.combiner = analysis.CombineMajority
+	case "weighted":
+		weights, err := parseWeights(detectFlags.weights)
+		if err != nil {
+			return nil, err
+		}
+		sel.combiner = analysis.CombineWeighted(weights)
+	default:
+		return nil, fmt.Errorf("--combine must be all, any, majority or weighted, got %q", detectFlags.combine)
+	}
+	return sel, nil
+}
+
+// parseWeights parses "name=weight,..." into a map.
+func parseWeights(s string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	if s == "" {
+		return weights, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight %q: expected name=weight", pair)
+		}
+		name = strings.TrimSpace(name)
+		if _, err := analysis.Lookup(name); err != nil && !(name == "model" && detectFlags.model != "") {
+			return nil, err
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %q", name, value)
+		}
+		weights[name] = w
+	}
+	return weights, nil
+}
+
+// analyzeImage runs the selected detectors on img, or the full analysis when
+// sel is nil.
+func analyzeImage(path string, img image.Image, sel *detectorSelection) detectReport {
+	var report detectReport
+	if sel == nil {
+		report = detectReport{Image: path, Result: analysis.Analyze(img)}
+	} else {
+		rep := analysis.Run(img, sel.detectors, sel.combiner)
+		report = detectReport{Image: path, Result: analysis.Result{Verdict: rep.Verdict}, Detectors: rep.Detectors}
+	}
+	if detectFlags.planes > 0 {
+		// runDetect has validated the plane count.
+		report.BitPlanes, _ = analysis.BitPlanes(img, detectFlags.planes)
+	}
+	return report
 }
 
 func runDetect() error {
+	switch detectFlags.format {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("--format must be text, json or csv, got %q", detectFlags.format)
+	}
+	if _, err := heatmapTiles(); err != nil {
+		return err
+	}
+	if detectFlags.planes < 0 || detectFlags.planes > 16 {
+		return fmt.Errorf("--planes must be between 0 and 16, got %d", detectFlags.planes)
+	}
+	sel, err := parseDetectorSelection()
+	if err != nil {
+		return err
+	}
+	if detectFlags.recursive != "" {
+		return runDetectRecursive(detectFlags.recursive, sel)
+	}
 	img, err := decodeImage(detectFlags.inputImage)
 	if err != nil {
 		return err
 	}
 
-	result := analysis.Analyze(img)
+	report := analyzeImage(detectFlags.inputImage, img, sel)
+	if detectFlags.heatmap != "" {
+		if report.Heatmap, err = writeHeatmap(img); err != nil {
+			return err
+		}
+	}
+
+	switch detectFlags.format {
+	case "json":
+		err = writeDetectJSON(os.Stdout, report)
+	case "csv":
+		err = writeDetectCSV(os.Stdout, sel, []detectReport{report})
+	default:
+		printDetectText(report)
+	}
+	if err != nil {
+		return err
+	}
+	return verdictExit(report.Verdict)
+}
+
+// verdictExit maps a verdict to the exit status documented in detect's help.
+func verdictExit(verdict string) error {
+	switch verdict {
+	case analysis.VerdictSuspicious:
+		return &exitError{code: exitSuspicious, err: errors.New(verdict)}
+	case analysis.VerdictLikelyStego:
+		return &exitError{code: exitLikelyStego, err: errors.New(verdict)}
+	}
+	return nil
+}
 
+func printDetectText(report detectReport) {
+	if len(report.Detectors) > 0 {
+		printDetectorsText(report)
+		return
+	}
+	result := report.Result
 	fmt.Println("Chi-square analysis (high p-value = suspicious):")
 	for _, r := range result.ChiSquare {
 		label := "CLEAN"
@@ -58,8 +332,121 @@ func runDetect() error {
 		}
 		fmt.Printf("  %s: Rm=%.4f  Sm=%.4f  R-m=%.4f  S-m=%.4f  asymmetry=%+.4f  [%s]\n",
 			r.Channel, r.Rm, r.Sm, r.Rnm, r.Snm, r.Asymmetry, label)
+		fmt.Printf("     rate=%.4f (%5.1f%%)  confidence=%.2f\n", r.Rate, r.Rate*100, r.Confidence)
 	}
 
+	fmt.Println("\nSample Pairs Analysis (estimated embedding rate):")
+	for _, r := range result.SPA {
+		label := "CLEAN"
+		if r.Suspicious {
+			label = "SUSPICIOUS"
+		}
+		fmt.Printf("  %s: rate=%.4f (%5.1f%%)  [%s]\n", r.Channel, r.Rate, r.Rate*100, label)
+	}
+
+	fmt.Println("\nWeighted-stego analysis (estimated embedding rate):")
+	for _, r := range result.WS {
+		label := "CLEAN"
+		if r.Suspicious {
+			label = "SUSPICIOUS"
+		}
+		fmt.Printf("  %s: rate=%.4f (%5.1f%%)  [%s]\n", r.Channel, r.Rate, r.Rate*100, label)
+	}
+
+	printBitPlanesText(report.BitPlanes)
+
 	fmt.Printf("\nVerdict: %s\n", result.Verdict)
-	return nil
+
+	if h := report.Heatmap; h != nil {
+		fmt.Printf("Heatmap (%s, %dpx tiles): %d/%d tiles suspicious → %s\n",
+			h.Test, h.Tile, h.Suspicious, h.Tiles, h.Path)
+	}
+}
+
+// printDetectorsText prints the results of --detectors / --combine runs.
+func printDetectorsText(report detectReport) {
+	for i, d := range report.Detectors {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", d.Detector)
+		for _, c := range d.Channels {
+			label := "CLEAN"
+			if c.Suspicious {
+				label = "SUSPICIOUS"
+			}
+			fmt.Printf("  %s: score=%.4f  confidence=%.2f  [%s]\n", c.Channel, c.Score, c.Confidence, label)
+		}
+	}
+
+	printBitPlanesText(report.BitPlanes)
+
+	fmt.Printf("\nVerdict (%s): %s\n", detectFlags.combine, report.Verdict)
+
+	if h := report.Heatmap; h != nil {
+		fmt.Printf("Heatmap (%s, %dpx tiles): %d/%d tiles suspicious → %s\n",
+			h.Test, h.Tile, h.Suspicious, h.Tiles, h.Path)
+	}
+}
+
+// printBitPlanesText prints the per-plane rate of each channel, marking the
+// planes counted as used, and the estimated number of planes.
+func printBitPlanesText(channels []analysis.BitPlaneChannel) {
+	if len(channels) == 0 {
+		return
+	}
+	fmt.Println("\nBit-plane analysis (rate per plane from the LSB up, * = used; chi-square p in brackets):")
+	for _, c := range channels {
+		fmt.Printf("  %s: %d plane(s) used\n    ", c.Channel, c.EstimatedPlanes)
+		for i, p := range c.Planes {
+			mark := " "
+			if p.Suspicious {
+				mark = "*"
+			}
+			switch {
+			case i > 0 && i%8 == 0:
+				fmt.Print("\n    ")
+			case i > 0:
+				fmt.Print("  ")
+			}
+			fmt.Printf("%d:%.2f%s(%.2f)", p.Plane, p.Rate, mark, p.PValue)
+		}
+		fmt.Println()
+	}
+}
+
+// heatmapTiles returns the tiled test selected by --heatmap-test.
+func heatmapTiles() (func(image.Image, analysis.TileOptions) (analysis.TileGrid, error), error) {
+	switch detectFlags.heatmapTest {
+	case "chi-square":
+		return analysis.ChiSquareTiles, nil
+	case "rs":
+		return analysis.RSTiles, nil
+	}
+	return nil, fmt.Errorf("--heatmap-test must be chi-square or rs, got %q", detectFlags.heatmapTest)
+}
+
+func writeHeatmap(img image.Image) (*heatmapSummary, error) {
+	tiles, err := heatmapTiles()
+	if err != nil {
+		return nil, err
+	}
+	g, err := tiles(img, analysis.TileOptions{Size: detectFlags.tileSize, Stride: detectFlags.tileStride})
+	if err != nil {
+		return nil, err
+	}
+	out, err := analysis.Heatmap(img, g)
+	if err != nil {
+		return nil, err
+	}
+	if err := encodeImage(detectFlags.heatmap, out); err != nil {
+		return nil, err
+	}
+	return &heatmapSummary{
+		Path:       detectFlags.heatmap,
+		Test:       g.Test,
+		Tile:       g.Size,
+		Tiles:      len(g.Scores),
+		Suspicious: g.Suspicious(),
+	}, nil
 }
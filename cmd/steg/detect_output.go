@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pableeee/steg/steg/analysis"
+)
+
+// writeDetectJSON writes v, a detectReport or a slice of them, as indented JSON.
+func writeDetectJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeDetectCSV writes one row per report. Every per-channel statistic gets
+// its own column, named <test>_<statistic>_<channel>, so each row is
+// self-contained and rows from different images line up. The header starts
+// with the columns of an RGB image; channels only some images have, such as A
+// or the single Y of a grayscale image, add columns after them, left empty in
+// the other rows. Reports for images that could not be analysed have an ERROR
+// verdict, empty statistics and the message in the final error column.
+func writeDetectCSV(w io.Writer, sel *detectorSelection, reports []detectReport) error {
+	header, _ := detectCSVRecord(emptyReport(sel))
+	column := make(map[string]int, len(header))
+	for i, name := range header {
+		column[name] = i
+	}
+	values := make([]map[string]string, len(reports))
+	for i, r := range reports {
+		if r.Error != "" {
+			values[i] = map[string]string{"image": r.Image, "verdict": verdictError}
+			continue
+		}
+		names, record := detectCSVRecord(r)
+		values[i] = make(map[string]string, len(names))
+		for j, name := range names {
+			values[i][name] = record[j]
+			if _, ok := column[name]; !ok {
+				column[name] = len(header)
+				header = append(header, name)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(header, "error")); err != nil {
+		return err
+	}
+	for i, r := range reports {
+		record := make([]string, len(header), len(header)+1)
+		for name, v := range values[i] {
+			record[column[name]] = v
+		}
+		if err := cw.Write(append(record, r.Error)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// detectCSVRecord flattens a report into a header and a matching record.
+func detectCSVRecord(r detectReport) (header, record []string) {
+	add := func(name, value string) {
+		header = append(header, name)
+		record = append(record, value)
+	}
+	num := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	flag := strconv.FormatBool
+
+	add("image", r.Image)
+	add("verdict", r.Verdict)
+	for _, c := range r.BitPlanes {
+		add("planes_"+c.Channel, strconv.Itoa(c.EstimatedPlanes))
+	}
+	if len(r.Detectors) > 0 {
+		for _, d := range r.Detectors {
+			for _, c := range d.Channels {
+				add(d.Detector+"_score_"+c.Channel, num(c.Score))
+				add(d.Detector+"_confidence_"+c.Channel, num(c.Confidence))
+				add(d.Detector+"_suspicious_"+c.Channel, flag(c.Suspicious))
+			}
+		}
+		return header, record
+	}
+	for _, c := range r.ChiSquare {
+		add("chi_sq_"+c.Channel, num(c.ChiSq))
+		add("chi_p_value_"+c.Channel, num(c.PValue))
+		add("chi_suspicious_"+c.Channel, flag(c.Suspicious))
+	}
+	for _, c := range r.RS {
+		add("rs_rm_"+c.Channel, num(c.Rm))
+		add("rs_sm_"+c.Channel, num(c.Sm))
+		add("rs_rnm_"+c.Channel, num(c.Rnm))
+		add("rs_snm_"+c.Channel, num(c.Snm))
+		add("rs_asymmetry_"+c.Channel, num(c.Asymmetry))
+		add("rs_rate_"+c.Channel, num(c.Rate))
+		add("rs_confidence_"+c.Channel, num(c.Confidence))
+		add("rs_suspicious_"+c.Channel, flag(c.Suspicious))
+	}
+	for _, c := range r.SPA {
+		add("spa_rate_"+c.Channel, num(c.Rate))
+		add("spa_suspicious_"+c.Channel, flag(c.Suspicious))
+	}
+	for _, c := range r.WS {
+		add("ws_rate_"+c.Channel, num(c.Rate))
+		add("ws_suspicious_"+c.Channel, flag(c.Suspicious))
+	}
+	return header, record
+}
+
+// emptyReport returns a report with one zero entry per R, G and B channel of
+// every test sel runs, so that detectCSVRecord produces the header of an RGB
+// image.
+func emptyReport(sel *detectorSelection) detectReport {
+	var r detectReport
+	channels := []string{"R", "G", "B"}
+	if detectFlags.planes > 0 {
+		for _, ch := range channels {
+			r.BitPlanes = append(r.BitPlanes, analysis.BitPlaneChannel{Channel: ch})
+		}
+	}
+	if sel != nil {
+		for _, d := range sel.detectors {
+			res := analysis.DetectorResult{Detector: d.Name()}
+			chs := channels
+			if _, ok := d.(*analysis.Model); ok {
+				chs = []string{"RGB"} // the model scores the image as a whole
+			}
+			for _, ch := range chs {
+				res.Channels = append(res.Channels, analysis.ChannelScore{Channel: ch})
+			}
+			r.Detectors = append(r.Detectors, res)
+		}
+		return r
+	}
+	for _, ch := range channels {
+		r.ChiSquare = append(r.ChiSquare, analysis.ChiSquareResult{Channel: ch})
+		r.RS = append(r.RS, analysis.RSResult{Channel: ch})
+		r.SPA = append(r.SPA, analysis.SPAResult{Channel: ch})
+		r.WS = append(r.WS, analysis.WSResult{Channel: ch})
+	}
+	return r
+}
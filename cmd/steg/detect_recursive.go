@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pableeee/steg/steg/analysis"
+)
+
+// verdictError marks a report for a file that could not be analysed.
+const verdictError = "ERROR"
+
+// runDetectRecursive analyses every supported image under dir and writes one
+// summary, most suspicious first, to stdout or --report.
+func runDetectRecursive(dir string, sel *detectorSelection) error {
+	if detectFlags.heatmap != "" {
+		return fmt.Errorf("--heatmap cannot be combined with --recursive")
+	}
+
+	var paths []string
+	var reports []detectReport
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			// Keep walking; the unreadable entry is reported like a bad image.
+			reports = append(reports, detectReport{Image: path, Error: err.Error()})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && isSupportedImage(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 && len(reports) == 0 {
+		return fmt.Errorf("no supported images found under %s", dir)
+	}
+
+	reports = append(reports, runPool(detectFlags.workers, paths, func(path string) detectReport {
+		img, err := decodeImage(path)
+		if err != nil {
+			return detectReport{Image: path, Error: err.Error()}
+		}
+		return analyzeImage(path, img, sel)
+	})...)
+	sortBySuspicion(reports)
+
+	out := io.Writer(os.Stdout)
+	if detectFlags.report != "" {
+		f, err := os.Create(detectFlags.report)
+		if err != nil {
+			return fmt.Errorf("unable to create report file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch detectFlags.format {
+	case "json":
+		err = writeDetectJSON(out, reports)
+	case "csv":
+		err = writeDetectCSV(out, sel, reports)
+	default:
+		err = writeDetectSummary(out, reports)
+	}
+	if err != nil {
+		return err
+	}
+	return summaryExit(reports)
+}
+
+// verdictRank orders verdicts from least to most suspicious; errors sort last.
+func verdictRank(verdict string) int {
+	switch verdict {
+	case analysis.VerdictLikelyStego:
+		return 3
+	case analysis.VerdictSuspicious:
+		return 2
+	case analysis.VerdictClean:
+		return 1
+	}
+	return 0
+}
+
+// suspicion returns how many per-channel tests flagged the image and the
+// highest embedding rate estimated by any detector. Chi-square p-values and
+// model probabilities are not rates and do not count towards the rate.
+func suspicion(r detectReport) (flags int, rate float64) {
+	results := r.Detectors
+	if results == nil {
+		results = r.Result.DetectorResults()
+	}
+	for _, d := range results {
+		for _, c := range d.Channels {
+			if c.Suspicious {
+				flags++
+			}
+			if d.Detector != "chi-square" && d.Detector != "model" {
+				rate = max(rate, c.Score)
+			}
+		}
+	}
+	return flags, rate
+}
+
+// sortBySuspicion orders reports by verdict, then number of flags, then the
+// highest estimated rate, all descending; ties and errors sort by path.
+func sortBySuspicion(reports []detectReport) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if ra, rb := verdictRank(reportVerdict(a)), verdictRank(reportVerdict(b)); ra != rb {
+			return ra > rb
+		}
+		fa, rateA := suspicion(a)
+		fb, rateB := suspicion(b)
+		if fa != fb {
+			return fa > fb
+		}
+		if rateA != rateB {
+			return rateA > rateB
+		}
+		return a.Image < b.Image
+	})
+}
+
+func reportVerdict(r detectReport) string {
+	if r.Error != "" {
+		return verdictError
+	}
+	return r.Verdict
+}
+
+func writeDetectSummary(w io.Writer, reports []detectReport) error {
+	counts := map[string]int{}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERDICT\tFLAGS\tMAX RATE\tPLANES\tIMAGE")
+	for _, r := range reports {
+		v := reportVerdict(r)
+		counts[v]++
+		if r.Error != "" {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t%s: %s\n", v, r.Image, r.Error)
+			continue
+		}
+		flags, rate := suspicion(r)
+		fmt.Fprintf(tw, "%s\t%d\t%.4f\t%s\t%s\n", v, flags, rate, planesSummary(r.BitPlanes), r.Image)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nScanned %d files: %d likely stego, %d suspicious, %d clean, %d errors.\n",
+		len(reports), counts[analysis.VerdictLikelyStego], counts[analysis.VerdictSuspicious],
+		counts[analysis.VerdictClean], counts[verdictError])
+	return err
+}
+
+// planesSummary formats the estimated planes per channel, e.g. "R2 G2 B0", or
+// "Y1" for a grayscale image, or "-" when bit planes were not analysed.
+func planesSummary(channels []analysis.BitPlaneChannel) string {
+	if len(channels) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(channels))
+	for i, c := range channels {
+		parts[i] = c.Channel + strconv.Itoa(c.EstimatedPlanes)
+	}
+	return strings.Join(parts, " ")
+}
+
+// summaryExit returns the exit status for the most suspicious verdict in
+// reports. Unreadable files only affect the status when nothing was flagged.
+func summaryExit(reports []detectReport) error {
+	worst, errs := analysis.VerdictClean, 0
+	for _, r := range reports {
+		if r.Error != "" {
+			errs++
+			continue
+		}
+		if verdictRank(r.Verdict) > verdictRank(worst) {
+			worst = r.Verdict
+		}
+	}
+	if worst == analysis.VerdictClean && errs > 0 {
+		return fmt.Errorf("%d of %d files could not be analysed", errs, len(reports))
+	}
+	return verdictExit(worst)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pableeee/steg/steg"
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var evaluateFlags = struct {
+	covers,
+	key,
+	detectors,
+	format,
+	output,
+	model,
+	roc string
+	rates,
+	fprs []float64
+	channels,
+	bitsPerChannel []int
+	workers int
+}{}
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Measure how well the detectors separate covers from stego images",
+	Long: `Runs every detector on each image in --covers and on stego variants of it,
+produced with steg encode for every combination of --channels,
+--bits-per-channel and --rates. For each detector and combination it reports
+the area under the ROC curve (AUC) and the detection rate (true-positive rate)
+at each false-positive rate in --fpr.
+
+An image's score for a detector is its highest per-channel score: the p-value
+for chi-square, the stego probability for a --model, the estimated embedding
+rate for the others.
+
+Encode always pads the image to capacity with random bytes, so the pixels
+change the same way whatever the payload size: --rates is expected to make no
+difference, and evaluating it confirms that payload size does not leak.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEvaluate()
+	},
+}
+
+func init() {
+	evaluateCmd.Flags().StringVar(&evaluateFlags.covers, "covers", "", "Directory of clean cover images (PNG, BMP, TIFF).")
+	evaluateCmd.Flags().StringVarP(&evaluateFlags.key, "password", "p", "steg-evaluate", "passphrase used to encode the stego variants")
+	evaluateCmd.Flags().Float64SliceVar(&evaluateFlags.rates, "rates", []float64{0.1, 0.5, 1}, "payload sizes as fractions of capacity")
+	evaluateCmd.Flags().IntSliceVarP(&evaluateFlags.channels, "channels", "c", []int{1, 3}, "channel counts to encode with")
+	evaluateCmd.Flags().IntSliceVarP(&evaluateFlags.bitsPerChannel, "bits-per-channel", "b", []int{1}, "bits-per-channel values to encode with")
+	evaluateCmd.Flags().Float64SliceVar(&evaluateFlags.fprs, "fpr", []float64{0.01, 0.05, 0.1}, "false-positive rates to report the detection rate at")
+	evaluateCmd.Flags().StringVar(
+		&evaluateFlags.detectors, "detectors", "",
+		"comma-separated detectors to evaluate: "+strings.Join(analysis.RegisteredDetectors(), ", ")+" (default all)",
+	)
+	evaluateCmd.Flags().StringVar(&evaluateFlags.model, "model", "", "Also evaluate a model file written by steg train.")
+	evaluateCmd.Flags().StringVar(&evaluateFlags.format, "format", "text", "output format: text, json or csv")
+	evaluateCmd.Flags().StringVarP(&evaluateFlags.output, "output", "o", "", "Write the results to this path instead of stdout.")
+	evaluateCmd.Flags().StringVar(&evaluateFlags.roc, "roc", "", "Also write every ROC point as CSV to this path.")
+	evaluateCmd.Flags().IntVarP(&evaluateFlags.workers, "workers", "w", 0, "number of covers processed concurrently (0 = number of CPUs)")
+	evaluateCmd.MarkFlagRequired("covers")
+}
+
+// evalConfig is one set of encoding parameters.
+type evalConfig struct {
+	Channels       int     `json:"channels"`
+	BitsPerChannel int     `json:"bits_per_channel"`
+	Rate           float64 `json:"payload_rate"`
+}
+
+// evalCover holds the detector scores for one cover and its stego variants.
+// Scores are indexed by detector, in the order of the evaluated detectors.
+type evalCover struct {
+	path  string
+	err   error
+	cover []float64
+	stego map[evalConfig][]float64
+}
+
+// tprAt is the detection rate at a fixed false-positive rate.
+type tprAt struct {
+	FPR float64 `json:"fpr"`
+	TPR float64 `json:"tpr"`
+}
+
+// evalResult is the performance of one detector against one evalConfig.
+type evalResult struct {
+	Detector string `json:"detector"`
+	evalConfig
+	Covers int                 `json:"covers"`
+	Stego  int                 `json:"stego"`
+	AUC    float64             `json:"auc"`
+	TPR    []tprAt             `json:"tpr_at_fpr"`
+	ROC    []analysis.ROCPoint `json:"roc"`
+}
+
+func runEvaluate() error {
+	switch evaluateFlags.format {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("--format must be text, json or csv, got %q", evaluateFlags.format)
+	}
+	detectors, err := evaluateDetectors()
+	if err != nil {
+		return err
+	}
+	configs, err := evaluateConfigs()
+	if err != nil {
+		return err
+	}
+
+	paths, err := listImages(evaluateFlags.covers)
+	if err != nil {
+		return err
+	}
+
+	pass := []byte(evaluateFlags.key)
+	samples := runPool(evaluateFlags.workers, paths, func(path string) evalCover {
+		return evaluateCover(path, pass, detectors, configs)
+	})
+
+	var results []evalResult
+	for _, cfg := range configs {
+		for i, d := range detectors {
+			var cover, stego []float64
+			for _, s := range samples {
+				if s.err != nil {
+					continue
+				}
+				cover = append(cover, s.cover[i])
+				if scores, ok := s.stego[cfg]; ok {
+					stego = append(stego, scores[i])
+				}
+			}
+			if len(stego) == 0 {
+				continue
+			}
+			roc := analysis.ROC(cover, stego)
+			res := evalResult{
+				Detector:   d.Name(),
+				evalConfig: cfg,
+				Covers:     len(cover),
+				Stego:      len(stego),
+				AUC:        analysis.AUC(roc),
+				ROC:        roc,
+			}
+			for _, fpr := range evaluateFlags.fprs {
+				res.TPR = append(res.TPR, tprAt{FPR: fpr, TPR: analysis.TPRAtFPR(roc, fpr)})
+			}
+			results = append(results, res)
+		}
+	}
+
+	for _, s := range samples {
+		if s.err != nil {
+			fmt.Fprintf(os.Stderr, "skipped %s: %v\n", s.path, s.err)
+		}
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no stego images could be produced from %s", evaluateFlags.covers)
+	}
+
+	out := io.Writer(os.Stdout)
+	if evaluateFlags.output != "" {
+		f, err := os.Create(evaluateFlags.output)
+		if err != nil {
+			return fmt.Errorf("unable to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	switch evaluateFlags.format {
+	case "json":
+		err = writeDetectJSON(out, results)
+	case "csv":
+		err = writeEvaluateCSV(out, results)
+	default:
+		err = writeEvaluateText(out, results)
+	}
+	if err != nil {
+		return err
+	}
+	if evaluateFlags.roc != "" {
+		return writeROCCSV(evaluateFlags.roc, results)
+	}
+	return nil
+}
+
+func evaluateDetectors() ([]analysis.Detector, error) {
+	names := analysis.RegisteredDetectors()
+	if evaluateFlags.detectors != "" {
+		names = strings.Split(evaluateFlags.detectors, ",")
+	}
+	var detectors []analysis.Detector
+	for _, name := range names {
+		d, err := analysis.Lookup(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		detectors = append(detectors, d)
+	}
+	if evaluateFlags.model != "" {
+		m, err := loadModel(evaluateFlags.model)
+		if err != nil {
+			return nil, err
+		}
+		detectors = append(detectors, m)
+	}
+	return detectors, nil
+}
+
+func evaluateConfigs() ([]evalConfig, error) {
+	var configs []evalConfig
+	for _, ch := range evaluateFlags.channels {
+		if ch < 1 || ch > 3 {
+			return nil, fmt.Errorf("channels must be between 1 and 3, got %d", ch)
+		}
+		for _, bpc := range evaluateFlags.bitsPerChannel {
+			if bpc < 1 || bpc > 8 {
+				return nil, fmt.Errorf("bits-per-channel must be between 1 and 8, got %d", bpc)
+			}
+			for _, rate := range evaluateFlags.rates {
+				if rate <= 0 || rate > 1 {
+					return nil, fmt.Errorf("rates must be in (0, 1], got %g", rate)
+				}
+				configs = append(configs, evalConfig{Channels: ch, BitsPerChannel: bpc, Rate: rate})
+			}
+		}
+	}
+	return configs, nil
+}
+
+// encodeOverhead is what steg.Encode embeds besides the payload: the 16-byte
+// salt, the 4-byte container and real lengths and the 32-byte tag.
+const encodeOverhead = 56
+
+// encodeCapacity returns the largest payload steg.Encode embeds in a w×h
+// image with the settings of cfg, so that a rate of 1 fills it exactly.
+func encodeCapacity(w, h int, cfg evalConfig) int {
+	return w*h*cfg.Channels*cfg.BitsPerChannel/8 - encodeOverhead
+}
+
+// evaluateCover scores one cover and every stego variant of it. A variant that
+// cannot be encoded (the image is too small for the settings) is left out.
+func evaluateCover(path string, pass []byte, detectors []analysis.Detector, configs []evalConfig) evalCover {
+	res := evalCover{path: path, stego: map[evalConfig][]float64{}}
+	src, err := decodeImage(path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.cover = imageScores(src, detectors)
+
+	b := src.Bounds()
+	for _, cfg := range configs {
+		size := int(float64(encodeCapacity(b.Dx(), b.Dy(), cfg)) * cfg.Rate)
+		if size <= 0 {
+			continue
+		}
+		payload := make([]byte, size)
+		if _, err := rand.Read(payload); err != nil {
+			res.err = err
+			return res
+		}
+		img := toDrawImage(src)
+		if err := steg.Encode(img, pass, bytes.NewReader(payload), cfg.BitsPerChannel, cfg.Channels); err != nil {
+			continue
+		}
+		res.stego[cfg] = imageScores(img, detectors)
+	}
+	return res
+}
+
+// imageScores returns each detector's highest per-channel score for img.
+func imageScores(img image.Image, detectors []analysis.Detector) []float64 {
+	scores := make([]float64, len(detectors))
+	for i, d := range detectors {
+		for _, c := range d.Detect(img) {
+			scores[i] = max(scores[i], c.Score)
+		}
+	}
+	return scores
+}
+
+func writeEvaluateText(w io.Writer, results []evalResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "DETECTOR\tCHANNELS\tBPC\tRATE\tAUC")
+	for _, t := range results[0].TPR {
+		fmt.Fprintf(tw, "\tTPR@%g%%", t.FPR*100)
+	}
+	fmt.Fprintln(tw)
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%g\t%.4f", r.Detector, r.Channels, r.BitsPerChannel, r.Rate, r.AUC)
+		for _, t := range r.TPR {
+			fmt.Fprintf(tw, "\t%.4f", t.TPR)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d covers; TPR@x%% is the detection rate when x%% of covers are falsely flagged.\n",
+		results[0].Covers)
+	return err
+}
+
+func writeEvaluateCSV(w io.Writer, results []evalResult) error {
+	cw := csv.NewWriter(w)
+	header := []string{"detector", "channels", "bits_per_channel", "payload_rate", "covers", "stego", "auc"}
+	for _, t := range results[0].TPR {
+		header = append(header, "tpr_at_fpr_"+strconv.FormatFloat(t.FPR, 'g', -1, 64))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range results {
+		record := []string{
+			r.Detector,
+			strconv.Itoa(r.Channels),
+			strconv.Itoa(r.BitsPerChannel),
+			strconv.FormatFloat(r.Rate, 'g', -1, 64),
+			strconv.Itoa(r.Covers),
+			strconv.Itoa(r.Stego),
+			strconv.FormatFloat(r.AUC, 'g', -1, 64),
+		}
+		for _, t := range r.TPR {
+			record = append(record, strconv.FormatFloat(t.TPR, 'g', -1, 64))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeROCCSV writes one row per ROC point of every result. The threshold of
+// the first point of each curve is written as +Inf.
+func writeROCCSV(path string, results []evalResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create ROC file: %w", err)
+	}
+	defer f.Close()
+	cw := csv.NewWriter(f)
+	if err := cw.Write([]string{"detector", "channels", "bits_per_channel", "payload_rate", "threshold", "fpr", "tpr"}); err != nil {
+		return err
+	}
+	for _, r := range results {
+		for _, p := range r.ROC {
+			if err := cw.Write([]string{
+				r.Detector,
+				strconv.Itoa(r.Channels),
+				strconv.Itoa(r.BitsPerChannel),
+				strconv.FormatFloat(r.Rate, 'g', -1, 64),
+				strconv.FormatFloat(p.Threshold, 'g', -1, 64),
+				strconv.FormatFloat(p.FPR, 'g', -1, 64),
+				strconv.FormatFloat(p.TPR, 'g', -1, 64),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
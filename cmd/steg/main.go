@@ -1,9 +1,44 @@
 package main
 
-import "os"
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+)
+
+// Process exit codes. Commands that need to tell callers more than success or
+// failure return an *exitError carrying one of the specific codes.
+const (
+	exitFailure  = 1
+	exitWrongKey = 2
+	exitCorrupt  = 3
+
+	// detect verdicts; CLEAN exits 0.
+	exitSuspicious  = 4
+	exitLikelyStego = 5
+)
+
+// exitError wraps err with the process exit code main should use for it.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	// Interrupting cancels the command's context, which stops a running
+	// encode or decode between chunks.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		var ee *exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
+		os.Exit(exitFailure)
 	}
 }
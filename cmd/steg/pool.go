@@ -0,0 +1,38 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// runPool calls fn for every item using at most workers goroutines and returns
+// the results in the same order as items. workers <= 0 means GOMAXPROCS.
+func runPool[T, R any](workers int, items []T, fn func(T) R) []R {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	results := make([]R, len(items))
+	idxChan := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range idxChan {
+				results[idx] = fn(items[idx])
+			}
+		}()
+	}
+
+	for i := range items {
+		idxChan <- i
+	}
+	close(idxChan)
+	wg.Wait()
+	return results
+}
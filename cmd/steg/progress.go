@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pableeee/steg/steg"
+)
+
+// progressDelay is how long an operation runs before its progress bar
+// appears, so that quick encodes and decodes print nothing.
+const progressDelay = 500 * time.Millisecond
+
+// progressWidth is the number of cells in the progress bar.
+const progressWidth = 30
+
+// progressBar draws the progress of an encode or decode on a single line of
+// w, redrawn in place, once the operation has run for progressDelay.
+type progressBar struct {
+	w       io.Writer
+	label   string
+	start   time.Time
+	percent int  // last percentage drawn, -1 before the first draw
+	drawn   bool // whether anything is on the line
+}
+
+// progressOption returns a steg option that shows a progress bar labelled
+// label on stderr, or no option when --no-progress is set or stderr is not a
+// terminal. Call the returned function once the operation has returned to
+// end the bar's line.
+func progressOption(label string) ([]steg.Option, func()) {
+	if noProgress || !isTerminal(os.Stderr) {
+		return nil, func() {}
+	}
+	p := &progressBar{w: os.Stderr, label: label, start: time.Now(), percent: -1}
+	return []steg.Option{steg.WithProgress(p.update)}, p.finish
+}
+
+// isTerminal reports whether f is a character device, i.e. an interactive
+// terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progressBar) update(done, total int64) {
+	if total <= 0 || time.Since(p.start) < progressDelay {
+		return
+	}
+	percent := int(done * 100 / total)
+	if percent == p.percent {
+		return
+	}
+	p.percent = percent
+	filled := percent * progressWidth / 100
+	fmt.Fprintf(p.w, "\r%s [%s%s] %3d%%  %9s / %s", p.label,
+		strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled),
+		percent, humanBytes(int(done)), humanBytes(int(total)))
+	p.drawn = true
+}
+
+func (p *progressBar) finish() {
+	if p.drawn {
+		fmt.Fprintln(p.w)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/draw"
@@ -12,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/pableeee/steg/steg"
+	"github.com/pableeee/steg/steg/analysis"
 	"github.com/spf13/cobra"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
@@ -20,6 +23,10 @@ import (
 var parallel bool
 var bitsPerChannel int
 var channels int
+var traversal string
+var permuteSlots bool
+var randomAccess bool
+var noProgress bool
 
 var (
 	rootCmd = &cobra.Command{
@@ -32,7 +39,7 @@ var (
 		Short: "Encodes inputfile into the provided image",
 		Long:  "Encodes inputfile into the provided image",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runEncode()
+			return silenceCancel(cmd, runEncode(cmd.Context()))
 		},
 	}
 
@@ -48,7 +55,7 @@ var (
 		Short: "Decodes a messages embedded on the provided image",
 		Long:  "Decodes a messages embedded on the provided image",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDecode()
+			return silenceCancel(cmd, runDecode(cmd.Context()))
 		},
 	}
 
@@ -101,6 +108,10 @@ func init() {
 	encodeCmd.Flags().BoolVarP(&parallel, "parallel", "P", false, "use parallel encode")
 	encodeCmd.Flags().IntVarP(&bitsPerChannel, "bits-per-channel", "b", 1, "number of LSBs to use per color channel (1-8)")
 	encodeCmd.Flags().IntVarP(&channels, "channels", "c", 3, "number of color channels to use: 1=R, 2=R+G, 3=R+G+B")
+	encodeCmd.Flags().StringVar(&traversal, "traversal", "fisher-yates", "pixel order: fisher-yates, feistel (constant memory) or chacha8 (Argon2id-keyed); decode with the encode setting")
+	encodeCmd.Flags().BoolVar(&permuteSlots, "permute-slots", false, "fill the bit slots of each pixel in a password-keyed order; decode with the encode setting")
+	encodeCmd.Flags().BoolVar(&randomAccess, "random-access", false, "tag every 4 KiB of payload so it can be read at random; decode with the encode setting")
+	encodeCmd.Flags().BoolVar(&noProgress, "no-progress", false, "do not show a progress bar on long encodes")
 	encodeCmd.MarkFlagRequired("password")
 
 	decodeCmd.Flags().StringVarP(
@@ -115,6 +126,10 @@ func init() {
 	decodeCmd.Flags().BoolVarP(&parallel, "parallel", "P", false, "use parallel decode")
 	decodeCmd.Flags().IntVarP(&bitsPerChannel, "bits-per-channel", "b", 1, "number of LSBs to use per color channel (1-8)")
 	decodeCmd.Flags().IntVarP(&channels, "channels", "c", 3, "number of color channels to use: 1=R, 2=R+G, 3=R+G+B")
+	decodeCmd.Flags().StringVar(&traversal, "traversal", "fisher-yates", "pixel order: fisher-yates, feistel (constant memory) or chacha8 (Argon2id-keyed); decode with the encode setting")
+	decodeCmd.Flags().BoolVar(&permuteSlots, "permute-slots", false, "fill the bit slots of each pixel in a password-keyed order; decode with the encode setting")
+	decodeCmd.Flags().BoolVar(&randomAccess, "random-access", false, "tag every 4 KiB of payload so it can be read at random; decode with the encode setting")
+	decodeCmd.Flags().BoolVar(&noProgress, "no-progress", false, "do not show a progress bar on long decodes")
 	decodeCmd.MarkFlagRequired("password")
 
 	capacityCmd.Flags().StringVarP(
@@ -140,6 +155,73 @@ func init() {
 	rootCmd.AddCommand(capacityCmd)
 	rootCmd.AddCommand(testVisualCmd)
 	rootCmd.AddCommand(detectCmd)
+	rootCmd.AddCommand(batchCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(visualizeCmd)
+	rootCmd.AddCommand(evaluateCmd)
+	rootCmd.AddCommand(trainCmd)
+}
+
+// silenceCancel returns err, suppressing the usage message when it reports an
+// interrupted command rather than a usage mistake.
+func silenceCancel(cmd *cobra.Command, err error) error {
+	if errors.Is(err, context.Canceled) {
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// validateEncodingFlags checks the shared --bits-per-channel, --channels and
+// --traversal values.
+func validateEncodingFlags() error {
+	if bitsPerChannel < 1 || bitsPerChannel > 8 {
+		return fmt.Errorf("--bits-per-channel must be between 1 and 8, got %d", bitsPerChannel)
+	}
+	if channels < 1 || channels > 3 {
+		return fmt.Errorf("--channels must be between 1 and 3, got %d", channels)
+	}
+	if traversal != "" {
+		if _, err := steg.ParseTraversal(traversal); err != nil {
+			return fmt.Errorf("--traversal must be fisher-yates, feistel or chacha8, got %q", traversal)
+		}
+	}
+	return nil
+}
+
+// encodingOptions returns the steg options selected by the shared encoding
+// flags, followed by extra. validateEncodingFlags has checked the flags.
+func encodingOptions(extra ...steg.Option) []steg.Option {
+	opts := []steg.Option{steg.WithBitsPerChannel(bitsPerChannel), steg.WithChannels(channels)}
+	if traversal != "" {
+		t, _ := steg.ParseTraversal(traversal)
+		opts = append(opts, steg.WithTraversal(t))
+	}
+	if permuteSlots {
+		opts = append(opts, steg.WithSlotPermutation())
+	}
+	if randomAccess {
+		opts = append(opts, steg.WithRandomAccess())
+	}
+	return append(opts, extra...)
+}
+
+// workersOption returns the steg worker count selected by --parallel: every
+// CPU, or only the calling goroutine.
+func workersOption() steg.Option {
+	if parallel {
+		return steg.WithWorkers(0)
+	}
+	return steg.WithWorkers(1)
+}
+
+// isSupportedImage reports whether path has an extension decodeImage handles.
+func isSupportedImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".bmp", ".tif", ".tiff":
+		return true
+	}
+	return false
 }
 
 func toDrawImage(src image.Image) draw.Image {
@@ -184,12 +266,9 @@ func encodeImage(path string, img image.Image) error {
 	}
 }
 
-func runEncode() error {
-	if bitsPerChannel < 1 || bitsPerChannel > 8 {
-		return fmt.Errorf("--bits-per-channel must be between 1 and 8, got %d", bitsPerChannel)
-	}
-	if channels < 1 || channels > 3 {
-		return fmt.Errorf("--channels must be between 1 and 3, got %d", channels)
+func runEncode(ctx context.Context) error {
+	if err := validateEncodingFlags(); err != nil {
+		return err
 	}
 
 	src, err := decodeImage(encoderFlags.inputImage)
@@ -204,11 +283,13 @@ func runEncode() error {
 	}
 	defer fmsg.Close()
 
-	if parallel {
-		err = steg.EncodeParallel(cimg, []byte(encoderFlags.key), bufio.NewReader(fmsg), bitsPerChannel, channels)
-	} else {
-		err = steg.Encode(cimg, []byte(encoderFlags.key), bufio.NewReader(fmsg), bitsPerChannel, channels)
+	progress, endProgress := progressOption("encoding")
+	enc, err := steg.NewEncoder(encodingOptions(append(progress, workersOption())...)...)
+	if err != nil {
+		return err
 	}
+	err = enc.Encode(ctx, cimg, []byte(encoderFlags.key), bufio.NewReader(fmsg))
+	endProgress()
 	if err != nil {
 		return err
 	}
@@ -216,12 +297,9 @@ func runEncode() error {
 	return encodeImage(encoderFlags.outputImage, cimg)
 }
 
-func runDecode() error {
-	if bitsPerChannel < 1 || bitsPerChannel > 8 {
-		return fmt.Errorf("--bits-per-channel must be between 1 and 8, got %d", bitsPerChannel)
-	}
-	if channels < 1 || channels > 3 {
-		return fmt.Errorf("--channels must be between 1 and 3, got %d", channels)
+func runDecode(ctx context.Context) error {
+	if err := validateEncodingFlags(); err != nil {
+		return err
 	}
 
 	src, err := decodeImage(decoderFlags.inputFile)
@@ -235,12 +313,13 @@ func runDecode() error {
 	}
 	defer out.Close()
 
-	var b []byte
-	if parallel {
-		b, err = steg.DecodeParallel(toDrawImage(src), []byte(decoderFlags.key), bitsPerChannel, channels)
-	} else {
-		b, err = steg.Decode(toDrawImage(src), []byte(decoderFlags.key), bitsPerChannel, channels)
+	progress, endProgress := progressOption("decoding")
+	dec, err := steg.NewDecoder(encodingOptions(append(progress, workersOption())...)...)
+	if err != nil {
+		return err
 	}
+	b, err := dec.Decode(ctx, toDrawImage(src), []byte(decoderFlags.key))
+	endProgress()
 	if err != nil {
 		return err
 	}
@@ -376,7 +455,13 @@ func runTestVisual() error {
 				return fmt.Errorf("encode %s: %w", outPath, err)
 			}
 
-			fmt.Printf("  ch=%d  bpc=%d  →  %-26s (%s bytes)\n", ch, bpc, name, formatBytes(cap))
+			dist, err := analysis.Compare(src, cimg)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("  ch=%d  bpc=%d  →  %-26s (%s bytes, PSNR %s, SSIM %.4f)\n",
+				ch, bpc, name, formatBytes(cap), formatPSNR(dist.PSNR), dist.SSIM)
 			written++
 		}
 	}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var trainFlags = struct {
+	covers,
+	stego,
+	output string
+	regularization float64
+	workers        int
+}{}
+
+var trainCmd = &cobra.Command{
+	Use:   "train",
+	Short: "Train a classifier on labelled cover and stego images",
+	Long: `Extracts rich-model features from every image in --covers and --stego and
+fits a Fisher linear discriminant separating the two sets. The features are
+co-occurrence histograms of pixel-difference residuals, which LSB embedding
+disturbs even at low rates.
+
+The model is written as JSON to --output; apply it with steg detect --model.
+A model only knows the kind of images and embedding it was trained on: train
+with covers like the images you will scan, and stego images produced the way
+you expect them to be (for example with steg evaluate's settings).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTrain()
+	},
+}
+
+func init() {
+	trainCmd.Flags().StringVar(&trainFlags.covers, "covers", "", "Directory of clean cover images (PNG, BMP, TIFF).")
+	trainCmd.Flags().StringVar(&trainFlags.stego, "stego", "", "Directory of images carrying embedded data.")
+	trainCmd.Flags().StringVarP(&trainFlags.output, "output", "o", "", "Path for the model file.")
+	trainCmd.Flags().Float64Var(
+		&trainFlags.regularization, "regularization", analysis.DefaultRegularization,
+		"ridge added to the scatter matrix; raise it if the model overfits small training sets",
+	)
+	trainCmd.Flags().IntVarP(&trainFlags.workers, "workers", "w", 0, "number of images processed concurrently (0 = number of CPUs)")
+	trainCmd.MarkFlagRequired("covers")
+	trainCmd.MarkFlagRequired("stego")
+	trainCmd.MarkFlagRequired("output")
+}
+
+// trainSample is the feature vector of one training image.
+type trainSample struct {
+	features []float64
+	err      error
+}
+
+func runTrain() error {
+	if trainFlags.regularization <= 0 {
+		return fmt.Errorf("--regularization must be positive, got %g", trainFlags.regularization)
+	}
+	cover, err := trainFeatures(trainFlags.covers)
+	if err != nil {
+		return err
+	}
+	stego, err := trainFeatures(trainFlags.stego)
+	if err != nil {
+		return err
+	}
+
+	m, err := analysis.TrainLDA(cover, stego, trainFlags.regularization)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(trainFlags.output)
+	if err != nil {
+		return fmt.Errorf("unable to create model file: %w", err)
+	}
+	if err := m.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Trained on %d cover and %d stego images (%d features).\n", m.TrainCovers, m.TrainStego, len(m.Weights))
+	fmt.Printf("Training accuracy: %.1f%%\n", m.TrainAccuracy*100)
+	fmt.Printf("Model written to %s\n", trainFlags.output)
+	return nil
+}
+
+// trainFeatures extracts the features of every image in dir. Unreadable
+// images are reported and skipped.
+func trainFeatures(dir string) ([][]float64, error) {
+	paths, err := listImages(dir)
+	if err != nil {
+		return nil, err
+	}
+	samples := runPool(trainFlags.workers, paths, func(path string) trainSample {
+		img, err := decodeImage(path)
+		if err != nil {
+			return trainSample{err: err}
+		}
+		return trainSample{features: analysis.ExtractFeatures(img)}
+	})
+
+	var features [][]float64
+	for i, s := range samples {
+		if s.err != nil {
+			fmt.Fprintf(os.Stderr, "skipped %s: %v\n", paths[i], s.err)
+			continue
+		}
+		features = append(features, s.features)
+	}
+	return features, nil
+}
+
+// listImages returns the supported images directly inside dir.
+func listImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && isSupportedImage(e.Name()) {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no supported images found in %s", dir)
+	}
+	return paths, nil
+}
+
+// loadModel reads a model file written by steg train.
+func loadModel(path string) (*analysis.Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open model: %w", err)
+	}
+	defer f.Close()
+	return analysis.LoadModel(f)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pableeee/steg/steg"
+	"github.com/spf13/cobra"
+)
+
+var verifyFlags = struct {
+	inputImage,
+	key string
+}{}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that an image's hidden payload is intact without extracting it",
+	Long: `Runs the full decode path, including HMAC verification, but discards the
+plaintext as it is read, so nothing is written to disk.
+
+Exit status:
+  0  payload intact
+  1  any other error (unreadable image, bad flags, ...)
+  2  wrong password, or --bits-per-channel / --channels / --traversal /
+     --permute-slots / --random-access differ from encode
+  3  password and parameters are right but the payload has been modified
+
+The 20-byte header (salt and container length) has no tag of its own, so
+damage to it cannot be told from a wrong password and also exits with 2.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Failures here are verdicts, not usage mistakes.
+		cmd.SilenceUsage = true
+		return runVerify()
+	},
+}
+
+func init() {
+	verifyCmd.Flags().StringVarP(
+		&verifyFlags.inputImage, "input_image", "i", "", "Image containing the hidden data.",
+	)
+	verifyCmd.Flags().StringVarP(
+		&verifyFlags.key, "password", "p", "", "passphrase used when encoding.",
+	)
+	verifyCmd.Flags().IntVarP(&bitsPerChannel, "bits-per-channel", "b", 1, "number of LSBs used per color channel (1-8)")
+	verifyCmd.Flags().IntVarP(&channels, "channels", "c", 3, "number of color channels used: 1=R, 2=R+G, 3=R+G+B")
+	verifyCmd.Flags().StringVar(&traversal, "traversal", "fisher-yates", "pixel order used at encode: fisher-yates, feistel or chacha8")
+	verifyCmd.Flags().BoolVar(&permuteSlots, "permute-slots", false, "the image was encoded with --permute-slots")
+	verifyCmd.Flags().BoolVar(&randomAccess, "random-access", false, "the image was encoded with --random-access")
+	verifyCmd.MarkFlagRequired("input_image")
+	verifyCmd.MarkFlagRequired("password")
+}
+
+func runVerify() error {
+	if err := validateEncodingFlags(); err != nil {
+		return err
+	}
+
+	src, err := decodeImage(verifyFlags.inputImage)
+	if err != nil {
+		return err
+	}
+
+	res, err := steg.Verify(toDrawImage(src), []byte(verifyFlags.key), bitsPerChannel, channels, encodingOptions()...)
+	switch {
+	case errors.Is(err, steg.ErrWrongKey):
+		return &exitError{code: exitWrongKey, err: err}
+	case errors.Is(err, steg.ErrCorrupt):
+		return &exitError{code: exitCorrupt, err: err}
+	case err != nil:
+		return err
+	}
+
+	fmt.Println("OK: payload intact")
+	fmt.Printf("  Payload size:  %s (%s bytes)\n", humanBytes(res.PayloadSize), formatBytes(res.PayloadSize))
+	fmt.Printf("  Capacity:      %s (%s bytes)\n", humanBytes(res.Capacity), formatBytes(res.Capacity))
+	fmt.Printf("  Parameters:    channels=%d  bits-per-channel=%d\n", res.Channels, res.BitsPerChannel)
+	return nil
+}
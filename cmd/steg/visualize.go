@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/spf13/cobra"
+)
+
+var visualizeFlags = struct {
+	cover,
+	stego,
+	inputImage,
+	channel,
+	outputImage string
+	amplify,
+	bit int
+}{}
+
+var (
+	visualizeCmd = &cobra.Command{
+		Use:   "visualize",
+		Short: "Render difference maps and bit planes for visual review",
+	}
+
+	visualizeDiffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Render an amplified per-channel difference map between cover and stego",
+		Long: `Writes an image whose R, G and B samples are |stego − cover| multiplied by
+--amplify and clamped to 255. With the default of 255 every changed sample is
+fully lit; lower values show the size of each change.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVisualizeDiff()
+		},
+	}
+
+	visualizeBitPlaneCmd = &cobra.Command{
+		Use:   "bitplane",
+		Short: "Render one bit plane of one channel as a black-and-white image",
+		Long: `Writes an image that is white where the chosen bit of the chosen channel is
+set. In a natural image the LSB plane still shows the picture's structure;
+embedded data replaces it with uniform noise.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVisualizeBitPlane()
+		},
+	}
+)
+
+func init() {
+	visualizeDiffCmd.Flags().StringVar(&visualizeFlags.cover, "cover", "", "Original carrier image (PNG, BMP, TIFF).")
+	visualizeDiffCmd.Flags().StringVar(&visualizeFlags.stego, "stego", "", "Image produced by encode.")
+	visualizeDiffCmd.Flags().IntVarP(&visualizeFlags.amplify, "amplify", "a", 255, "multiplier applied to each absolute difference")
+	visualizeDiffCmd.Flags().StringVarP(
+		&visualizeFlags.outputImage, "output_image", "o", "", "Path for the rendered image (PNG, BMP, TIFF).",
+	)
+	visualizeDiffCmd.MarkFlagRequired("cover")
+	visualizeDiffCmd.MarkFlagRequired("stego")
+	visualizeDiffCmd.MarkFlagRequired("output_image")
+
+	visualizeBitPlaneCmd.Flags().StringVarP(
+		&visualizeFlags.inputImage, "input_image", "i", "", "Image to render (PNG, BMP, TIFF).",
+	)
+	visualizeBitPlaneCmd.Flags().StringVar(&visualizeFlags.channel, "channel", "R", "color channel: R, G or B")
+	visualizeBitPlaneCmd.Flags().IntVar(&visualizeFlags.bit, "bit", 0, "bit plane to render, 0 (LSB) to 7 (MSB)")
+	visualizeBitPlaneCmd.Flags().StringVarP(
+		&visualizeFlags.outputImage, "output_image", "o", "", "Path for the rendered image (PNG, BMP, TIFF).",
+	)
+	visualizeBitPlaneCmd.MarkFlagRequired("input_image")
+	visualizeBitPlaneCmd.MarkFlagRequired("output_image")
+
+	visualizeCmd.AddCommand(visualizeDiffCmd)
+	visualizeCmd.AddCommand(visualizeBitPlaneCmd)
+}
+
+func runVisualizeDiff() error {
+	cover, err := decodeImage(visualizeFlags.cover)
+	if err != nil {
+		return err
+	}
+	stego, err := decodeImage(visualizeFlags.stego)
+	if err != nil {
+		return err
+	}
+	out, err := analysis.DiffMap(cover, stego, visualizeFlags.amplify)
+	if err != nil {
+		return err
+	}
+	return encodeImage(visualizeFlags.outputImage, out)
+}
+
+func runVisualizeBitPlane() error {
+	ch := strings.Index("RGB", strings.ToUpper(visualizeFlags.channel))
+	if len(visualizeFlags.channel) != 1 || ch < 0 {
+		return fmt.Errorf("--channel must be R, G or B, got %q", visualizeFlags.channel)
+	}
+	src, err := decodeImage(visualizeFlags.inputImage)
+	if err != nil {
+		return err
+	}
+	out, err := analysis.BitPlane(src, ch, visualizeFlags.bit)
+	if err != nil {
+		return err
+	}
+	return encodeImage(visualizeFlags.outputImage, out)
+}
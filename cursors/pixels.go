@@ -0,0 +1,92 @@
+package cursors
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// pixelFormat identifies how RNGCursor reaches the pixels of its image.
+type pixelFormat int
+
+const (
+	// pixelGeneric goes through draw.Image: At(...).RGBA() to read and Set
+	// with a color.RGBA to write.
+	pixelGeneric pixelFormat = iota
+	// pixel8 reads and writes the Pix slice of *image.RGBA and *image.NRGBA
+	// directly: 4 bytes per pixel.
+	pixel8
+	// pixel16 reads and writes the Pix slice of *image.RGBA64 and
+	// *image.NRGBA64 directly: 8 bytes per pixel, each sample big-endian.
+	pixel16
+)
+
+// directPixels returns the format, Pix slice and stride to use for img. Only
+// images whose bounds start at the origin qualify, since the traversal covers
+// (0,0)–Max. Everything else uses pixelGeneric.
+//
+// The direct formats embed in the samples as stored. For opaque 8-bit images
+// this is exactly what the generic path does. For non-premultiplied images with
+// translucent pixels it avoids the premultiply/unpremultiply round trip of At
+// and Set, and for 16-bit images it embeds in the low bits of the 16-bit
+// sample and leaves the high byte intact; the generic path stores only 8 bits
+// per sample there. In both cases the low byte of every sample, and so the
+// embedded bits, read back the same through either path.
+func directPixels(img draw.Image) (pixelFormat, []uint8, int) {
+	var origin image.Point
+	switch m := img.(type) {
+	case *image.RGBA:
+		if m.Rect.Min == origin {
+			return pixel8, m.Pix, m.Stride
+		}
+	case *image.NRGBA:
+		if m.Rect.Min == origin {
+			return pixel8, m.Pix, m.Stride
+		}
+	case *image.RGBA64:
+		if m.Rect.Min == origin {
+			return pixel16, m.Pix, m.Stride
+		}
+	case *image.NRGBA64:
+		if m.Rect.Min == origin {
+			return pixel16, m.Pix, m.Stride
+		}
+	}
+	return pixelGeneric, nil, 0
+}
+
+// readPixel returns the samples of pixel (x, y).
+func (c *RNGCursor) readPixel(x, y int) (r, g, b, a uint32) {
+	switch c.format {
+	case pixel8:
+		i := y*c.stride + x*4
+		s := c.pix[i : i+4 : i+4]
+		return uint32(s[0]), uint32(s[1]), uint32(s[2]), uint32(s[3])
+	case pixel16:
+		i := y*c.stride + x*8
+		s := c.pix[i : i+8 : i+8]
+		return uint32(s[0])<<8 | uint32(s[1]), uint32(s[2])<<8 | uint32(s[3]),
+			uint32(s[4])<<8 | uint32(s[5]), uint32(s[6])<<8 | uint32(s[7])
+	}
+	return c.img.At(x, y).RGBA()
+}
+
+// writePixel stores the samples of pixel (x, y). Cursors sharing an image may
+// write concurrently only to disjoint pixels.
+func (c *RNGCursor) writePixel(x, y int, r, g, b, a uint32) {
+	switch c.format {
+	case pixel8:
+		i := y*c.stride + x*4
+		s := c.pix[i : i+4 : i+4]
+		s[0], s[1], s[2], s[3] = uint8(r), uint8(g), uint8(b), uint8(a)
+	case pixel16:
+		i := y*c.stride + x*8
+		s := c.pix[i : i+8 : i+8]
+		s[0], s[1] = uint8(r>>8), uint8(r)
+		s[2], s[3] = uint8(g>>8), uint8(g)
+		s[4], s[5] = uint8(b>>8), uint8(b)
+		s[6], s[7] = uint8(a>>8), uint8(a)
+	default:
+		c.img.Set(x, y, color.RGBA{uint8(r), uint8(g), uint8(b), uint8(a)})
+	}
+}
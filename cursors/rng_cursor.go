@@ -3,11 +3,9 @@ package cursors
 import (
 	"fmt"
 	"image"
-	"image/color"
 	"image/draw"
 	"io"
 	"math/rand"
-	"sync"
 )
 
 func GenerateSequence(width, height int, seed int64) []image.Point {
@@ -34,25 +32,35 @@ func generateSequence(width, height int, rng *rand.Rand) []image.Point {
 }
 
 type RNGCursor struct {
-	img             draw.Image
-	cursor          int64
-	bitMask         BitColor
-	bitCount        uint
-	bitsPerChannel  int
-	useBits         []BitColor
-	points          []image.Point
-	rng             *rand.Rand
-	maxBits         int64 // pre-computed capacity in bits
-
-	// imgMu, when non-nil, is locked around every img.At() and img.Set() call.
-	// Set via WithImageMutex to eliminate data races when multiple cursors share
-	// the same draw.Image (e.g. parallel encode workers).
-	imgMu *sync.Mutex
-
-	// pixel cache — amortises img.At() and img.Set() across the bits of one pixel.
-	// Write-back: img.Set() is deferred until the cursor leaves the current pixel
-	// (via loadPixel or Flush), so each pixel costs one At + one Set regardless
-	// of how many of its bits are modified.
+	img            draw.Image
+	cursor         int64
+	bitMask        BitColor
+	bitCount       uint
+	bitsPerChannel int
+	useBits        []BitColor
+	traversal      Traversal
+	rng            *rand.Rand
+	maxBits        int64 // pre-computed capacity in bits
+
+	// format, pix and stride select the direct Pix access path for the image
+	// types it supports (see directPixels); pix is nil otherwise.
+	format pixelFormat
+	pix    []uint8
+	stride int
+
+	// slotOrder maps the logical bit slots of the cached pixel to physical
+	// ones: slot s is bit slotOrder[s] of the pixel, counting channel by
+	// channel and MSB-first within a channel. It is the identity unless
+	// permuteSlots is set, in which case loadPixel reloads it per pixel from
+	// slotKey (see WithSlotKey).
+	slotOrder    []uint8
+	slotKey      uint64
+	permuteSlots bool
+
+	// pixel cache — amortises pixel reads and writes across the bits of one pixel.
+	// Write-back: the write is deferred until the cursor leaves the current pixel
+	// (via loadPixel or Flush), so each pixel costs one read + one write
+	// regardless of how many of its bits are modified.
 	pixelCached bool
 	dirty       bool
 	cacheIdx    int64
@@ -85,18 +93,17 @@ func WithSeed(seed int64) Option {
 }
 
 func WithSharedPoints(points []image.Point) Option {
-	return func(c *RNGCursor) { c.points = points }
+	return func(c *RNGCursor) { c.traversal = Points(points) }
 }
 
-func WithBitsPerChannel(n int) Option {
-	return func(c *RNGCursor) { c.bitsPerChannel = n }
+// WithTraversal sets the order in which pixels are visited. By default the
+// cursor shuffles the pixels with the rng set by WithSeed.
+func WithTraversal(t Traversal) Option {
+	return func(c *RNGCursor) { c.traversal = t }
 }
 
-// WithImageMutex sets a shared mutex that will be locked around every img.At()
-// and img.Set() call. Pass the same *sync.Mutex to all cursors that share an
-// image to eliminate data races in parallel encode/decode scenarios.
-func WithImageMutex(mu *sync.Mutex) Option {
-	return func(c *RNGCursor) { c.imgMu = mu }
+func WithBitsPerChannel(n int) Option {
+	return func(c *RNGCursor) { c.bitsPerChannel = n }
 }
 
 func NewRNGCursor(img draw.Image, options ...Option) *RNGCursor {
@@ -105,8 +112,9 @@ func NewRNGCursor(img draw.Image, options ...Option) *RNGCursor {
 		opt(c)
 	}
 
-	if c.points == nil {
-		c.points = generateSequence(img.Bounds().Max.X, img.Bounds().Max.Y, c.rng)
+	c.format, c.pix, c.stride = directPixels(img)
+	if c.traversal == nil {
+		c.traversal = Points(generateSequence(img.Bounds().Max.X, img.Bounds().Max.Y, c.rng))
 	}
 	for _, color := range Colors {
 		if c.bitMask&color == color {
@@ -115,6 +123,10 @@ func NewRNGCursor(img draw.Image, options ...Option) *RNGCursor {
 		}
 	}
 	c.maxBits = int64(img.Bounds().Max.X) * int64(img.Bounds().Max.Y) * int64(c.bitCount) * int64(c.bitsPerChannel)
+	c.slotOrder = make([]uint8, int(c.bitCount)*c.bitsPerChannel)
+	for i := range c.slotOrder {
+		c.slotOrder[i] = uint8(i)
+	}
 	return c
 }
 
@@ -130,14 +142,7 @@ func (c *RNGCursor) validateBounds(n int64) bool {
 // Must be called after the final WriteByte before the cursor is abandoned.
 func (c *RNGCursor) Flush() {
 	if c.dirty {
-		px := color.RGBA{uint8(c.cacheR), uint8(c.cacheG), uint8(c.cacheB), uint8(c.cacheA)}
-		if c.imgMu != nil {
-			c.imgMu.Lock()
-			c.img.Set(c.cacheX, c.cacheY, px)
-			c.imgMu.Unlock()
-		} else {
-			c.img.Set(c.cacheX, c.cacheY, px)
-		}
+		c.writePixel(c.cacheX, c.cacheY, c.cacheR, c.cacheG, c.cacheB, c.cacheA)
 		c.dirty = false
 	}
 }
@@ -145,14 +150,10 @@ func (c *RNGCursor) Flush() {
 // loadPixel flushes the current dirty pixel (if any) then loads pixelIdx into cache.
 func (c *RNGCursor) loadPixel(pixelIdx int64) {
 	c.Flush()
-	pt := c.points[pixelIdx]
-	var r, g, b, a uint32
-	if c.imgMu != nil {
-		c.imgMu.Lock()
-		r, g, b, a = c.img.At(pt.X, pt.Y).RGBA()
-		c.imgMu.Unlock()
-	} else {
-		r, g, b, a = c.img.At(pt.X, pt.Y).RGBA()
+	pt := c.traversal.Point(pixelIdx)
+	r, g, b, a := c.readPixel(pt.X, pt.Y)
+	if c.permuteSlots {
+		c.loadSlotOrder(pixelIdx)
 	}
 	c.cacheIdx = pixelIdx
 	c.cacheX, c.cacheY = pt.X, pt.Y
@@ -192,7 +193,8 @@ func (c *RNGCursor) Seek(n int64, whence int) (int64, error) {
 // ReadByte reads 8 bits MSB-first from the cursor.
 // Slot arithmetic accounts for bitsPerChannel: each pixel holds
 // bitCount*bitsPerChannel bit slots, ordered by channel then by bit
-// position within the channel (MSB-first within each channel's N bits).
+// position within the channel (MSB-first within each channel's N bits),
+// or in the keyed order of WithSlotKey.
 func (c *RNGCursor) ReadByte() (uint8, error) {
 	bitsPerPixel := int64(c.bitCount) * int64(c.bitsPerChannel)
 	pixelIdx := c.cursor / bitsPerPixel
@@ -206,8 +208,7 @@ func (c *RNGCursor) ReadByte() (uint8, error) {
 		if !c.pixelCached || pixelIdx != c.cacheIdx {
 			c.loadPixel(pixelIdx)
 		}
-		channelIdx := slotInPixel / c.bitsPerChannel
-		bitInChannel := (c.bitsPerChannel - 1) - (slotInPixel % c.bitsPerChannel)
+		channelIdx, bitInChannel := c.slot(slotInPixel)
 		var val uint32
 		switch c.useBits[channelIdx] {
 		case R_Bit:
@@ -229,11 +230,12 @@ func (c *RNGCursor) ReadByte() (uint8, error) {
 }
 
 // WriteByte writes 8 bits MSB-first to the cursor.
-// Uses write-back caching: img.Set() is deferred until the cursor moves to the
-// next pixel or Flush() is called — one Set per pixel regardless of bit count.
+// Uses write-back caching: the pixel write is deferred until the cursor moves to
+// the next pixel or Flush() is called — one write per pixel regardless of bit count.
 // Slot arithmetic accounts for bitsPerChannel: each pixel holds
 // bitCount*bitsPerChannel bit slots, ordered by channel then by bit
-// position within the channel (MSB-first within each channel's N bits).
+// position within the channel (MSB-first within each channel's N bits),
+// or in the keyed order of WithSlotKey.
 func (c *RNGCursor) WriteByte(b uint8) error {
 	bitsPerPixel := int64(c.bitCount) * int64(c.bitsPerChannel)
 	pixelIdx := c.cursor / bitsPerPixel
@@ -246,8 +248,7 @@ func (c *RNGCursor) WriteByte(b uint8) error {
 		if !c.pixelCached || pixelIdx != c.cacheIdx {
 			c.loadPixel(pixelIdx) // flushes previous dirty pixel
 		}
-		channelIdx := slotInPixel / c.bitsPerChannel
-		bitInChannel := (c.bitsPerChannel - 1) - (slotInPixel % c.bitsPerChannel)
+		channelIdx, bitInChannel := c.slot(slotInPixel)
 		bit := (b >> i) & 1
 		mask := uint32(1) << bitInChannel
 		switch c.useBits[channelIdx] {
@@ -3,7 +3,9 @@ package cursors_test
 import (
 	"bytes"
 	"image"
+	"image/draw"
 	"io"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -146,3 +148,288 @@ func TestRNGCursor(t *testing.T) {
 	// 	assert.Equal(t, payload, readBack, "Should correctly handle reading/writing with 16-bit depth images")
 	// })
 }
+
+// drawOnly hides the concrete type of an image, forcing RNGCursor onto the
+// generic draw.Image path.
+type drawOnly struct{ draw.Image }
+
+// randomPix fills pix with random samples, setting every alpha byte (each
+// stride-th byte from alpha, width wide) to 0xff.
+func randomPix(pix []uint8, stride, alpha, width int) {
+	rng := rand.New(rand.NewSource(1))
+	rng.Read(pix)
+	for i := 0; i < len(pix); i += stride {
+		for j := 0; j < width; j++ {
+			pix[i+alpha+j] = 0xff
+		}
+	}
+}
+
+func TestRNGCursorDirectPixels(t *testing.T) {
+	opts := []cursors.Option{cursors.UseGreenBit(), cursors.UseBlueBit(), cursors.WithBitsPerChannel(2), cursors.WithSeed(7)}
+	payload := bytes.Repeat([]byte("direct pixel access "), 20)
+	rect := image.Rect(0, 0, 40, 30)
+
+	t.Run("8-bit matches draw.Image", func(t *testing.T) {
+		for name, newImg := range map[string]func() (draw.Image, []uint8){
+			"RGBA":  func() (draw.Image, []uint8) { m := image.NewRGBA(rect); return m, m.Pix },
+			"NRGBA": func() (draw.Image, []uint8) { m := image.NewNRGBA(rect); return m, m.Pix },
+		} {
+			t.Run(name, func(t *testing.T) {
+				direct, pix := newImg()
+				generic, genericPix := newImg()
+				randomPix(pix, 4, 3, 1)
+				copy(genericPix, pix)
+
+				readBack := writeAndReadAll(t, cursors.CursorAdapter(cursors.NewRNGCursor(direct, opts...)), payload)
+				assert.Equal(t, payload, readBack)
+				_, err := cursors.CursorAdapter(cursors.NewRNGCursor(drawOnly{generic}, opts...)).Write(payload)
+				require.NoError(t, err)
+				assert.Equal(t, genericPix, pix, "both paths write the same pixels")
+			})
+		}
+	})
+
+	t.Run("16-bit keeps the high byte", func(t *testing.T) {
+		for name, newImg := range map[string]func() (draw.Image, []uint8){
+			"RGBA64":  func() (draw.Image, []uint8) { m := image.NewRGBA64(rect); return m, m.Pix },
+			"NRGBA64": func() (draw.Image, []uint8) { m := image.NewNRGBA64(rect); return m, m.Pix },
+		} {
+			t.Run(name, func(t *testing.T) {
+				img, pix := newImg()
+				randomPix(pix, 8, 6, 2)
+				orig := append([]uint8(nil), pix...)
+
+				readBack := writeAndReadAll(t, cursors.CursorAdapter(cursors.NewRNGCursor(img, opts...)), payload)
+				assert.Equal(t, payload, readBack)
+				for i := 0; i < len(pix); i += 2 {
+					require.Equal(t, orig[i], pix[i], "high byte of sample %d", i/2)
+				}
+
+				// The generic path reads the same low bits.
+				got := make([]byte, len(payload))
+				_, err := cursors.CursorAdapter(cursors.NewRNGCursor(drawOnly{img}, opts...)).Read(got)
+				require.NoError(t, err)
+				assert.Equal(t, payload, got)
+			})
+		}
+	})
+
+	t.Run("translucent NRGBA round trip", func(t *testing.T) {
+		img := image.NewNRGBA(rect)
+		for i := range img.Pix {
+			img.Pix[i] = uint8(i * 7)
+			if i%4 == 3 {
+				img.Pix[i] = 0x80
+			}
+		}
+		readBack := writeAndReadAll(t, cursors.CursorAdapter(cursors.NewRNGCursor(img, opts...)), payload)
+		assert.Equal(t, payload, readBack)
+	})
+
+	t.Run("offset bounds use draw.Image", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(5, 5, 45, 35))
+		generic := image.NewRGBA(img.Rect)
+		_, err := cursors.CursorAdapter(cursors.NewRNGCursor(img, opts...)).Write(payload[:50])
+		require.NoError(t, err)
+		_, err = cursors.CursorAdapter(cursors.NewRNGCursor(drawOnly{generic}, opts...)).Write(payload[:50])
+		require.NoError(t, err)
+		assert.Equal(t, generic.Pix, img.Pix)
+	})
+}
+
+// benchImages are the image types benchmarked by BenchmarkRNGCursor*: the
+// four with direct Pix access and an RGBA image behind the draw.Image
+// interface, which is the path every image took before.
+var benchImages = []struct {
+	name string
+	new  func(r image.Rectangle) draw.Image
+}{
+	{"RGBA", func(r image.Rectangle) draw.Image { return image.NewRGBA(r) }},
+	{"NRGBA", func(r image.Rectangle) draw.Image { return image.NewNRGBA(r) }},
+	{"RGBA64", func(r image.Rectangle) draw.Image { return image.NewRGBA64(r) }},
+	{"NRGBA64", func(r image.Rectangle) draw.Image { return image.NewNRGBA64(r) }},
+	{"draw.Image", func(r image.Rectangle) draw.Image { return drawOnly{image.NewRGBA(r)} }},
+}
+
+// BenchmarkRNGCursorWrite writes 100 KB into a 1000x1000 image with 3 bits per
+// pixel. The traversal is generated once, so only pixel access is measured.
+// Run with: go test ./cursors/ -bench=BenchmarkRNGCursor -benchmem
+func BenchmarkRNGCursorWrite(b *testing.B) {
+	rect := image.Rect(0, 0, 1000, 1000)
+	points := cursors.GenerateSequence(rect.Dx(), rect.Dy(), 1)
+	payload := bytes.Repeat([]byte{0xa5, 0x5a}, 50*1024)
+	for _, tc := range benchImages {
+		b.Run(tc.name, func(b *testing.B) {
+			cur := cursors.NewRNGCursor(tc.new(rect), cursors.UseGreenBit(), cursors.UseBlueBit(), cursors.WithSharedPoints(points))
+			adapter := cursors.CursorAdapter(cur)
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := adapter.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := adapter.Write(payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRNGCursorRead reads 100 KB back from a 1000x1000 image with 3 bits
+// per pixel.
+func BenchmarkRNGCursorRead(b *testing.B) {
+	rect := image.Rect(0, 0, 1000, 1000)
+	points := cursors.GenerateSequence(rect.Dx(), rect.Dy(), 1)
+	buf := make([]byte, 100*1024)
+	for _, tc := range benchImages {
+		b.Run(tc.name, func(b *testing.B) {
+			cur := cursors.NewRNGCursor(tc.new(rect), cursors.UseGreenBit(), cursors.UseBlueBit(), cursors.WithSharedPoints(points))
+			adapter := cursors.CursorAdapter(cur)
+			b.SetBytes(int64(len(buf)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := adapter.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.ReadFull(adapter, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRNGCursorSlotKey(t *testing.T) {
+	raster := make(cursors.Points, 0, 4*4)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			raster = append(raster, image.Point{X: x, Y: y})
+		}
+	}
+	// writeOnes writes 0xFF at the start of a blank 4x4 image through a
+	// 1-bit, 3-channel cursor: pixels 0 and 1 take three bits each and
+	// pixel 2 the last two, leaving one channel of pixel 2 clear.
+	writeOnes := func(opts ...cursors.Option) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		opts = append(opts, cursors.WithTraversal(raster), cursors.UseGreenBit(), cursors.UseBlueBit())
+		require.NoError(t, cursors.NewRNGCursor(img, opts...).WriteByte(0xFF))
+		return img
+	}
+
+	assert.Equal(t, []uint8{1, 1, 0}, writeOnes().Pix[8:11], "fixed order fills R, G, B")
+	clear := make(map[int]bool)
+	for k := 0; k < 32; k++ {
+		img := writeOnes(cursors.WithSlotKey([]byte{byte(k)}))
+		assert.Equal(t, []uint8{1, 1, 1, 0, 1, 1, 1, 0}, img.Pix[:8], "slots stay within their pixel")
+		for ch, v := range img.Pix[8:11] {
+			if v == 0 {
+				clear[ch] = true
+			}
+		}
+		assert.Equal(t, img.Pix, writeOnes(cursors.WithSlotKey([]byte{byte(k)})).Pix, "equal keys give equal orders")
+	}
+	assert.Len(t, clear, 3, "the unfilled slot of a partial pixel moves between channels")
+
+	for _, bpc := range []int{1, 3, 8} {
+		img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+		payload := []byte("keyed slot order within each pixel")
+		cur := cursors.NewRNGCursor(img, cursors.WithSeed(1), cursors.WithBitsPerChannel(bpc),
+			cursors.UseGreenBit(), cursors.UseBlueBit(), cursors.WithSlotKey([]byte("slots")))
+		assert.Equal(t, payload, writeAndReadAll(t, cursors.CursorAdapter(cur), payload), "%d bits per channel", bpc)
+	}
+}
+
+func TestFeistelTraversal(t *testing.T) {
+	key := []byte("traversal key")
+	for _, size := range []image.Point{{1, 1}, {2, 3}, {7, 13}, {64, 64}, {1000, 3}, {257, 1}} {
+		tr := cursors.NewFeistelTraversal(size.X, size.Y, key)
+		n := size.X * size.Y
+		seen := make(map[image.Point]bool, n)
+		for i := 0; i < n; i++ {
+			p := tr.Point(int64(i))
+			require.True(t, p.In(image.Rect(0, 0, size.X, size.Y)), "%v: %v out of bounds", size, p)
+			require.False(t, seen[p], "%v: %v visited twice", size, p)
+			seen[p] = true
+		}
+	}
+
+	a := cursors.NewFeistelTraversal(64, 64, key)
+	b := cursors.NewFeistelTraversal(64, 64, key)
+	c := cursors.NewFeistelTraversal(64, 64, []byte("other key"))
+	same, identity := 0, 0
+	for i := int64(0); i < 64*64; i++ {
+		require.Equal(t, a.Point(i), b.Point(i), "equal keys give equal traversals")
+		if a.Point(i) == c.Point(i) {
+			same++
+		}
+		if a.Point(i) == (image.Point{X: int(i % 64), Y: int(i / 64)}) {
+			identity++
+		}
+	}
+	assert.Less(t, same, 64, "different keys give different traversals")
+	assert.Less(t, identity, 64, "the traversal is not the raster order")
+
+	t.Run("round trip", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+		tr := cursors.NewFeistelTraversal(30, 20, key)
+		payload := []byte("feistel traversal")
+		cur := cursors.NewRNGCursor(img, cursors.WithTraversal(tr), cursors.UseGreenBit())
+		assert.Equal(t, payload, writeAndReadAll(t, cursors.CursorAdapter(cur), payload))
+	})
+}
+
+func TestShuffleChaCha8(t *testing.T) {
+	key := [32]byte{1, 2, 3}
+	for _, size := range []image.Point{{1, 1}, {2, 3}, {7, 13}, {64, 64}} {
+		tr := cursors.ShuffleChaCha8(size.X, size.Y, key)
+		require.Len(t, tr, size.X*size.Y)
+		seen := make(map[image.Point]bool, len(tr))
+		for _, p := range tr {
+			require.True(t, p.In(image.Rect(0, 0, size.X, size.Y)), "%v: %v out of bounds", size, p)
+			require.False(t, seen[p], "%v: %v visited twice", size, p)
+			seen[p] = true
+		}
+	}
+
+	a := cursors.ShuffleChaCha8(64, 64, key)
+	assert.Equal(t, a, cursors.ShuffleChaCha8(64, 64, key), "equal keys give equal traversals")
+	c := cursors.ShuffleChaCha8(64, 64, [32]byte{1, 2, 4})
+	same := 0
+	for i := range a {
+		if a[i] == c[i] {
+			same++
+		}
+	}
+	assert.Less(t, same, 64, "different keys give different traversals")
+
+	// The order is pinned to the ChaCha8 stream: a change here would make
+	// existing images undecodable.
+	assert.Equal(t, cursors.Points{{1, 0}, {1, 1}, {2, 0}, {0, 0}, {0, 1}, {2, 1}}, cursors.ShuffleChaCha8(3, 2, key))
+}
+
+// BenchmarkTraversal builds a traversal of a 2000x2000 image and visits every
+// pixel: the Fisher-Yates shuffle allocates 16 bytes per pixel up front, the
+// Feistel traversal nothing.
+func BenchmarkTraversal(b *testing.B) {
+	const w, h = 2000, 2000
+	b.Run("fisher-yates", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tr := cursors.Points(cursors.GenerateSequence(w, h, 1))
+			for j := int64(0); j < w*h; j++ {
+				_ = tr.Point(j)
+			}
+		}
+	})
+	b.Run("feistel", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tr := cursors.NewFeistelTraversal(w, h, []byte("key"))
+			for j := int64(0); j < w*h; j++ {
+				_ = tr.Point(j)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package cursors
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+)
+
+// WithSlotKey permutes the bit slots of every pixel. Without it, the slots of
+// a pixel are filled channel by channel, MSB-first within each channel's bits,
+// so the first bits of the stream and the tail of a partly filled last pixel
+// always land in the same channels. With it, each pixel fills its slots in an
+// order selected by key and the pixel's index in the traversal; equal keys
+// give equal orders.
+//
+// The permutation never moves a bit to another pixel, so the pixel boundaries
+// of the stream are unchanged.
+func WithSlotKey(key []byte) Option {
+	return func(c *RNGCursor) {
+		h := sha256.Sum256(key)
+		c.slotKey = binary.LittleEndian.Uint64(h[:8])
+		c.permuteSlots = true
+	}
+}
+
+// loadSlotOrder sets slotOrder to the slot permutation of pixelIdx: a
+// Fisher-Yates shuffle of the identity driven by a splitmix64 stream seeded
+// from slotKey and pixelIdx.
+func (c *RNGCursor) loadSlotOrder(pixelIdx int64) {
+	for i := range c.slotOrder {
+		c.slotOrder[i] = uint8(i)
+	}
+	state := c.slotKey ^ uint64(pixelIdx)*0x9e3779b97f4a7c15
+	for i := len(c.slotOrder) - 1; i > 0; i-- {
+		state += 0x9e3779b97f4a7c15
+		// The bias of a 64-bit multiply-shift over at most 24 values is
+		// below 2⁻⁵⁹; unlike rejection it draws exactly once per slot.
+		j, _ := bits.Mul64(mix64(state), uint64(i+1))
+		c.slotOrder[i], c.slotOrder[j] = c.slotOrder[j], c.slotOrder[i]
+	}
+}
+
+// slot returns the channel index and bit position of logical slot s of the
+// cached pixel.
+func (c *RNGCursor) slot(s int) (channelIdx int, bitInChannel uint) {
+	p := int(c.slotOrder[s])
+	return p / c.bitsPerChannel, uint(c.bitsPerChannel - 1 - p%c.bitsPerChannel)
+}
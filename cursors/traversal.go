@@ -0,0 +1,121 @@
+package cursors
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"math/bits"
+	"math/rand/v2"
+)
+
+// Traversal is the order in which RNGCursor visits the pixels of an image:
+// Point(i) is the i-th pixel visited, for i from 0 to width·height − 1. A
+// Traversal must be a permutation of the image's pixels and safe for
+// concurrent use, since parallel workers share one.
+type Traversal interface {
+	Point(i int64) image.Point
+}
+
+// Points is a materialised traversal, such as the shuffled sequence returned
+// by GenerateSequence. It costs 16 bytes per pixel.
+type Points []image.Point
+
+// Point returns p[i].
+func (p Points) Point(i int64) image.Point { return p[i] }
+
+// ShuffleChaCha8 returns the pixels of a width×height image in a Fisher-Yates
+// order drawn from a ChaCha8 stream keyed with key. GenerateSequence seeds
+// math/rand, which reduces its seed modulo 2³¹−1 and so has about two billion
+// possible orders; here the order is selected by a full 256-bit key.
+//
+// The shuffle is defined by the ChaCha8 output stream and the sampling below,
+// not by math/rand/v2's helpers, so the order cannot change between Go
+// releases.
+func ShuffleChaCha8(width, height int, key [32]byte) Points {
+	src := rand.NewChaCha8(key)
+	n := width * height
+	positions := make(Points, n)
+	for i := range positions {
+		positions[i] = image.Point{X: i % width, Y: i / width}
+	}
+	for i := n - 1; i > 0; i-- {
+		j := uniform(src, uint64(i+1))
+		positions[i], positions[j] = positions[j], positions[i]
+	}
+	return positions
+}
+
+// uniform returns a uniformly distributed value in [0, n) drawn from src, by
+// Lemire's multiply-and-reject method.
+func uniform(src *rand.ChaCha8, n uint64) uint64 {
+	hi, lo := bits.Mul64(src.Uint64(), n)
+	if lo < n {
+		threshold := -n % n
+		for lo < threshold {
+			hi, lo = bits.Mul64(src.Uint64(), n)
+		}
+	}
+	return hi
+}
+
+// feistelRounds is the number of rounds of FeistelTraversal's network.
+const feistelRounds = 6
+
+// FeistelTraversal is a keyed pseudorandom permutation of the pixels of an
+// image, computed one index at a time instead of materialised: it uses O(1)
+// memory and needs no set-up pass, however large the image.
+//
+// Pixel indices are permuted by a balanced Feistel network over the smallest
+// even number of bits that covers them; an output outside the image is fed
+// back in (cycle walking) until it lands inside, which keeps the mapping a
+// permutation and takes fewer than four passes on average. The round function
+// is a fast 64-bit mixer, not a cryptographic PRF: like the Fisher-Yates
+// traversal, the order only hides where the encrypted payload lies.
+type FeistelTraversal struct {
+	width int
+	n     uint64 // number of pixels
+	half  uint   // bits per Feistel half
+	mask  uint64 // low half bits
+	keys  [feistelRounds]uint64
+}
+
+// NewFeistelTraversal returns the traversal of a width×height image selected
+// by key. Equal keys give equal traversals.
+func NewFeistelTraversal(width, height int, key []byte) *FeistelTraversal {
+	n := uint64(width) * uint64(height)
+	half := uint(1)
+	if n > 1 {
+		half = max(1, uint(bits.Len64(n-1)+1)/2)
+	}
+	f := &FeistelTraversal{width: width, n: n, half: half, mask: 1<<half - 1}
+	for r := range f.keys {
+		h := sha256.Sum256(append([]byte{byte(r)}, key...))
+		f.keys[r] = binary.LittleEndian.Uint64(h[:8])
+	}
+	return f
+}
+
+// Point returns the i-th pixel of the traversal.
+func (f *FeistelTraversal) Point(i int64) image.Point {
+	x := f.permute(uint64(i))
+	for x >= f.n {
+		x = f.permute(x)
+	}
+	return image.Point{X: int(x % uint64(f.width)), Y: int(x / uint64(f.width))}
+}
+
+// permute applies the Feistel network to x < 2^(2·half).
+func (f *FeistelTraversal) permute(x uint64) uint64 {
+	l, r := x>>f.half, x&f.mask
+	for _, k := range f.keys {
+		l, r = r, l^(mix64(r^k)&f.mask)
+	}
+	return l<<f.half | r
+}
+
+// mix64 is the splitmix64 finaliser.
+func mix64(z uint64) uint64 {
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
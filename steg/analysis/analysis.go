@@ -1,8 +1,14 @@
 // Package analysis implements statistical steganalysis detectors for LSB
-// steganography. It provides two complementary tests:
+// steganography. It provides four complementary tests:
 //
 //   - Chi-square: detects global LSB histogram uniformity caused by embedding.
 //   - RS analysis: detects local pixel smoothness asymmetry caused by embedding.
+//   - Sample Pairs Analysis: estimates the fraction of samples carrying data.
+//   - Weighted stego (WS): estimates the same fraction from pixel prediction.
+//
+// Each test is also registered as a Detector under the names "chi-square",
+// "rs", "spa" and "ws". Run executes any set of registered detectors, including
+// ones added with Register, and merges their results with a Combiner.
 package analysis
 
 import "image"
@@ -10,59 +16,108 @@ import "image"
 // ChiSquareResult holds the per-channel result of the chi-square test.
 // A high PValue (> 0.05) means the LSB distribution is suspiciously uniform.
 type ChiSquareResult struct {
-	Channel    string
-	ChiSq      float64
-	PValue     float64 // high = suspicious
-	Suspicious bool
+	Channel    string  `json:"channel"`
+	ChiSq      float64 `json:"chi_sq"`
+	PValue     float64 `json:"p_value"` // high = suspicious
+	Suspicious bool    `json:"suspicious"`
 }
 
 // RSResult holds the per-channel result of the RS analysis.
-// Asymmetry = Rm - Rnm; positive values indicate embedding.
+// Asymmetry = Rm - Rnm; positive values indicate embedding. The fractions and
+// Asymmetry come from the first mask; Rate and Confidence combine all masks.
 type RSResult struct {
-	Channel    string
-	Rm, Sm     float64 // regular/singular fractions under positive mask
-	Rnm, Snm   float64 // regular/singular fractions under negative mask
-	Asymmetry  float64 // Rm - Rnm; > 0 = suspicious
-	Suspicious bool
+	Channel    string         `json:"channel"`
+	Rm         float64        `json:"rm"`        // regular fraction under positive mask
+	Sm         float64        `json:"sm"`        // singular fraction under positive mask
+	Rnm        float64        `json:"rnm"`       // regular fraction under negative mask
+	Snm        float64        `json:"snm"`       // singular fraction under negative mask
+	Asymmetry  float64        `json:"asymmetry"` // Rm - Rnm; > 0 = suspicious
+	Suspicious bool           `json:"suspicious"`
+	Rate       float64        `json:"rate"`       // estimated embedding rate in [0,1], mean over masks
+	Confidence float64        `json:"confidence"` // [0,1]; share of masks with an estimate × their agreement
+	Masks      []RSMaskResult `json:"masks"`
+}
+
+// RSMaskResult holds the RS statistics and length estimate for a single mask.
+// Valid is false when the length equation was degenerate for this mask.
+type RSMaskResult struct {
+	Mask  string  `json:"mask"`
+	Rm    float64 `json:"rm"`
+	Sm    float64 `json:"sm"`
+	Rnm   float64 `json:"rnm"`
+	Snm   float64 `json:"snm"`
+	Rate  float64 `json:"rate"`
+	Valid bool    `json:"valid"`
+}
+
+// SPAResult holds the per-channel result of Sample Pairs Analysis.
+// Rate is the estimated fraction of samples carrying embedded bits, in [0,1].
+type SPAResult struct {
+	Channel    string  `json:"channel"`
+	Rate       float64 `json:"rate"` // estimated embedding rate; > 0.05 = suspicious
+	Suspicious bool    `json:"suspicious"`
+}
+
+// WSResult holds the per-channel result of the weighted-stego estimator.
+// Rate is the estimated fraction of samples carrying embedded bits, in [0,1];
+// the expected fraction of samples actually changed is Rate/2.
+type WSResult struct {
+	Channel    string  `json:"channel"`
+	Rate       float64 `json:"rate"` // estimated embedding rate; > 0.05 = suspicious
+	Suspicious bool    `json:"suspicious"`
 }
 
-// Result is the combined detection output for an image.
+// Verdicts reported in Result.Verdict.
+const (
+	VerdictClean       = "CLEAN"
+	VerdictSuspicious  = "SUSPICIOUS"
+	VerdictLikelyStego = "LIKELY_STEGO"
+)
+
+// Result is the combined detection output for an image. It marshals to JSON
+// with snake_case keys.
 type Result struct {
-	ChiSquare []ChiSquareResult
-	RS        []RSResult
-	Verdict   string // "CLEAN", "SUSPICIOUS", or "LIKELY_STEGO"
+	ChiSquare []ChiSquareResult `json:"chi_square"`
+	RS        []RSResult        `json:"rs"`
+	SPA       []SPAResult       `json:"spa"`
+	WS        []WSResult        `json:"ws"`
+	Verdict   string            `json:"verdict"` // "CLEAN", "SUSPICIOUS", or "LIKELY_STEGO"
 }
 
-// Analyze runs both the chi-square and RS analysis on img and returns a
-// combined Result with an overall verdict.
+// Analyze runs the chi-square, RS, SPA and WS tests on every channel of img
+// and returns a combined Result with an overall verdict. The verdict counts the
+// chi-square and RS flags, combined with CombineAll; the SPA and WS rate
+// estimates are reported alongside it, and vote only when chosen through Run.
+// The channels depend on the colour model: R, G and B for colour images, Y for
+// grayscale, plus A when the image has transparency, at 8 or 16 bits as
+// stored.
 func Analyze(img image.Image) Result {
-	cs := ChiSquare(img)
-	rs := RSAnalysis(img)
+	channels := imageChannels(img)
+	w := img.Bounds().Dx()
+	cs := chiSquareChannels(channels)
+	rs := rsChannels(channels, w, DefaultMasks)
+	spa := spaChannels(channels, w)
+	ws := wsChannels(channels, w)
 	return Result{
 		ChiSquare: cs,
 		RS:        rs,
+		SPA:       spa,
+		WS:        ws,
 		Verdict:   verdict(cs, rs),
 	}
 }
 
-func verdict(cs []ChiSquareResult, rs []RSResult) string {
-	hits, total := 0, len(cs)+len(rs)
-	for _, r := range cs {
-		if r.Suspicious {
-			hits++
-		}
-	}
-	for _, r := range rs {
-		if r.Suspicious {
-			hits++
-		}
-	}
-	switch {
-	case hits == 0:
-		return "CLEAN"
-	case hits < total:
-		return "SUSPICIOUS"
-	default:
-		return "LIKELY_STEGO"
+// DetectorResults returns r in the form Run produces, one entry per test
+// under its registered detector name.
+func (r Result) DetectorResults() []DetectorResult {
+	return []DetectorResult{
+		{Detector: "chi-square", Channels: chiSquareScores(r.ChiSquare)},
+		{Detector: "rs", Channels: rsScores(r.RS)},
+		{Detector: "spa", Channels: spaScores(r.SPA)},
+		{Detector: "ws", Channels: wsScores(r.WS)},
 	}
 }
+
+func verdict(cs []ChiSquareResult, rs []RSResult) string {
+	return CombineAll.Combine(Result{ChiSquare: cs, RS: rs}.DetectorResults())
+}
@@ -1,7 +1,7 @@
 // Package analysis_test verifies the chi-square and RS steganalysis detectors
 // using images produced by the steg encoder.
 //
-// Test image notes
+// # Test image notes
 //
 // naturalImage generates a synthetic image where all channel values are even
 // (LSB = 0). This gives chi-square a clear clean baseline: pairs (2k, 2k+1)
@@ -22,6 +22,9 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/pableeee/steg/steg"
@@ -46,6 +49,51 @@ func naturalImage(w, h int) *image.RGBA {
 	return img
 }
 
+// photoImage returns a deterministic photo-like image: smooth overlapping
+// gradients plus mild Gaussian noise. Unlike naturalImage its LSBs are not
+// artificially structured, so the quantitative estimators (SPA, WS) see the
+// near-zero clean baseline they are designed for.
+func photoImage(w, h int) *image.RGBA {
+	return photoImageSeed(w, h, 1)
+}
+
+// photoImageSeed is photoImage with a chosen noise seed; the seed also shifts
+// the gradients so that different seeds give different scenes.
+func photoImageSeed(w, h int, seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	off := float64(seed-1) * 13
+	clamp := func(v float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(255, v)))) }
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			fx, fy := float64(x)+off, float64(y)+off/2
+			base := 128 + 40*math.Sin(fx/23)*math.Cos(fy/31) + 30*math.Sin((fx+fy)/57) + 20*math.Cos(fx/11-fy/17)
+			img.Set(x, y, color.RGBA{
+				R: clamp(base + rng.NormFloat64()*2),
+				G: clamp(base*0.8 + 25 + rng.NormFloat64()*2),
+				B: clamp(base*0.6 + 45 + rng.NormFloat64()*2),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// embedLSB returns a copy of src in which each R, G and B sample is, with
+// probability rate, given a random LSB. steg.Encode always pads to full
+// capacity, so this is how the tests produce partial embedding rates.
+func embedLSB(src *image.RGBA, rate float64) *image.RGBA {
+	rng := rand.New(rand.NewSource(2))
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	for i := range dst.Pix {
+		if i%4 != 3 && rng.Float64() < rate {
+			dst.Pix[i] = dst.Pix[i]&^1 | uint8(rng.Intn(2))
+		}
+	}
+	return dst
+}
+
 // capacity returns the usable byte capacity of a w×h image encoded with 3
 // channels and 1 bit per channel (default steg settings), minus the 56-byte
 // overhead (16 enc-salt + 4 container-length + 4 real-length + 32 HMAC).
@@ -194,6 +242,186 @@ func TestRSDetectionLimits(t *testing.T) {
 	}
 }
 
+// TestRSEstimatesRate verifies that the length estimate follows the true
+// embedding rate and that the default masks agree on a photo-like image.
+func TestRSEstimatesRate(t *testing.T) {
+	src := photoImage(300, 300)
+	for _, rate := range []float64{0.1, 0.25, 0.5, 0.75} {
+		for _, r := range analysis.RSAnalysis(embedLSB(src, rate)) {
+			assert.InDelta(t, rate, r.Rate, 0.1,
+				"channel %s at true rate %.2f estimated %.4f", r.Channel, rate, r.Rate)
+			assert.Greater(t, r.Confidence, 0.0, "channel %s at rate %.2f", r.Channel, rate)
+			assert.LessOrEqual(t, r.Confidence, 1.0)
+		}
+	}
+	for _, r := range analysis.RSAnalysis(embedLSB(src, 0.5)) {
+		require.Len(t, r.Masks, len(analysis.DefaultMasks))
+		assert.Greater(t, r.Confidence, 0.8, "masks should agree on channel %s", r.Channel)
+	}
+}
+
+func TestRSWithMasks(t *testing.T) {
+	img := embedLSB(photoImage(300, 300), 0.5)
+	masks := []analysis.Mask{analysis.MaskVertical, analysis.MaskHorizontalInner, analysis.MaskSquare}
+	for _, m := range masks {
+		results, err := analysis.RSAnalysisWithMasks(img, m)
+		require.NoError(t, err)
+		for _, r := range results {
+			require.Len(t, r.Masks, 1)
+			assert.Equal(t, m.Name, r.Masks[0].Mask)
+			assert.True(t, r.Masks[0].Valid, "mask %s channel %s", m.Name, r.Channel)
+			assert.InDelta(t, 0.5, r.Rate, 0.1, "mask %s channel %s", m.Name, r.Channel)
+			assert.Equal(t, r.Masks[0].Rm-r.Masks[0].Rnm, r.Asymmetry)
+		}
+	}
+
+	// The primary mask supplies the legacy fields, so RSAnalysis is unchanged
+	// for callers that only read Rm, Rnm and Asymmetry.
+	def := analysis.RSAnalysis(img)
+	only, err := analysis.RSAnalysisWithMasks(img, analysis.MaskHorizontal)
+	require.NoError(t, err)
+	for i := range def {
+		assert.Equal(t, only[i].Asymmetry, def[i].Asymmetry)
+	}
+}
+
+func TestRSInvalidMasks(t *testing.T) {
+	img := photoImage(32, 32)
+	_, err := analysis.RSAnalysisWithMasks(img)
+	assert.Error(t, err, "no masks")
+	for _, m := range []analysis.Mask{
+		{Name: "empty"},
+		{Name: "zero", Grid: [][]int{{0, 0, 0}}},
+		{Name: "ragged", Grid: [][]int{{1, 0}, {1}}},
+		{Name: "range", Grid: [][]int{{2, 0}}},
+		{Name: "single", Grid: [][]int{{1}}},
+	} {
+		_, err := analysis.RSAnalysisWithMasks(img, m)
+		assert.Error(t, err, "mask %s", m.Name)
+	}
+}
+
+// ── SPA tests ─────────────────────────────────────────────────────────────────
+
+func TestSPAClean(t *testing.T) {
+	results := analysis.SPA(photoImage(300, 300))
+	require.Len(t, results, 3)
+	for _, r := range results {
+		assert.False(t, r.Suspicious, "clean channel %s estimated at %.4f", r.Channel, r.Rate)
+	}
+}
+
+// TestSPATracksRate verifies that the estimate follows the true embedding rate.
+func TestSPATracksRate(t *testing.T) {
+	src := photoImage(300, 300)
+	for _, rate := range []float64{0.1, 0.25, 0.5, 0.75} {
+		for _, r := range analysis.SPA(embedLSB(src, rate)) {
+			assert.InDelta(t, rate, r.Rate, 0.1,
+				"channel %s at true rate %.2f estimated %.4f", r.Channel, rate, r.Rate)
+		}
+	}
+}
+
+// TestSPAEncodedChannels encodes with steg.Encode into R only: because the
+// encoder pads to capacity, R is fully embedded while G and B stay clean.
+func TestSPAEncodedChannels(t *testing.T) {
+	img := photoImage(300, 300)
+	require.NoError(t, steg.Encode(img, []byte("spapass"), bytes.NewReader([]byte("hi")), 1, 1))
+	results := analysis.SPA(img)
+	assert.Greater(t, results[0].Rate, 0.8, "R should be estimated as fully embedded")
+	assert.True(t, results[0].Suspicious)
+	for _, r := range results[1:] {
+		assert.False(t, r.Suspicious, "untouched channel %s estimated at %.4f", r.Channel, r.Rate)
+	}
+}
+
+// TestSPADetectionLimits logs the SPA estimate at increasing embedding rates.
+func TestSPADetectionLimits(t *testing.T) {
+	src := photoImage(300, 300)
+	rates := []float64{0, 0.01, 0.05, 0.10, 0.25, 0.50, 0.75, 1.00}
+
+	t.Log("rate%  R_est     G_est     B_est")
+	for _, rate := range rates {
+		rs := analysis.SPA(embedLSB(src, rate))
+		t.Logf("%5.0f%%  %.4f    %.4f    %.4f", rate*100, rs[0].Rate, rs[1].Rate, rs[2].Rate)
+	}
+}
+
+// ── WS tests ──────────────────────────────────────────────────────────────────
+
+func TestWSClean(t *testing.T) {
+	for _, img := range []*image.RGBA{photoImage(300, 300), naturalImage(300, 300)} {
+		for _, r := range analysis.WS(img) {
+			assert.False(t, r.Suspicious, "clean channel %s estimated at %.4f", r.Channel, r.Rate)
+		}
+	}
+}
+
+// TestWSTracksRate verifies that the estimate follows the true embedding rate.
+func TestWSTracksRate(t *testing.T) {
+	src := photoImage(300, 300)
+	for _, rate := range []float64{0.05, 0.1, 0.25, 0.5, 0.75, 1} {
+		for _, r := range analysis.WS(embedLSB(src, rate)) {
+			assert.InDelta(t, rate, r.Rate, 0.05,
+				"channel %s at true rate %.2f estimated %.4f", r.Channel, rate, r.Rate)
+		}
+	}
+}
+
+// TestWSTracksPayloadSize encodes with steg.Encode into the top rows of the
+// image only. The encoder pads to the capacity of the image it is given, so a
+// strip of h rows filled with a payload of its capacity changes the LSBs at a
+// true rate of h/300 of the whole image.
+func TestWSTracksPayloadSize(t *testing.T) {
+	prev := []float64{-1, -1, -1}
+	for _, h := range []int{30, 75, 150, 225, 300} {
+		img := photoImage(300, 300)
+		strip := img.SubImage(image.Rect(0, 0, 300, h)).(*image.RGBA)
+		size := capacity(300, h)
+		require.NoError(t, steg.Encode(strip, []byte("wspass"), bytes.NewReader(make([]byte, size)), 1, 3))
+
+		rate := float64(h) / 300
+		for ch, r := range analysis.WS(img) {
+			assert.InDelta(t, rate, r.Rate, 0.05,
+				"size=%d: channel %s at true rate %.2f estimated %.4f", size, r.Channel, rate, r.Rate)
+			assert.Greater(t, r.Rate, prev[ch],
+				"size=%d: channel %s estimate did not grow with the payload", size, r.Channel)
+			prev[ch] = r.Rate
+		}
+	}
+}
+
+// TestWSEncodedChannels encodes with steg.Encode into 1, 2 and 3 channels.
+// The encoder pads to capacity, so whatever the payload size the true rate is
+// 1 for every channel in use and 0 for the others.
+func TestWSEncodedChannels(t *testing.T) {
+	for channels := 1; channels <= 3; channels++ {
+		img := photoImage(300, 300)
+		require.NoError(t, steg.Encode(img, []byte("wspass"), bytes.NewReader([]byte("hi")), 1, channels))
+
+		for ch, r := range analysis.WS(img) {
+			want := 0.0
+			if ch < channels {
+				want = 1
+			}
+			assert.InDelta(t, want, r.Rate, 0.1,
+				"channels=%d: channel %s estimated %.4f", channels, r.Channel, r.Rate)
+		}
+	}
+}
+
+// TestWSDetectionLimits checks where the 0.05 threshold flags a channel:
+// never at rates of 1% or less, always from 10%.
+func TestWSDetectionLimits(t *testing.T) {
+	src := photoImage(300, 300)
+	for _, rate := range []float64{0, 0.01, 0.10, 0.25, 0.50, 1.00} {
+		for _, r := range analysis.WS(embedLSB(src, rate)) {
+			assert.Equal(t, rate >= 0.10, r.Suspicious,
+				"channel %s at true rate %.2f estimated %.4f", r.Channel, rate, r.Rate)
+		}
+	}
+}
+
 // ── Combined Analyze tests ────────────────────────────────────────────────────
 
 func TestAnalyzeClean(t *testing.T) {
@@ -202,6 +430,17 @@ func TestAnalyzeClean(t *testing.T) {
 	assert.Equal(t, "CLEAN", result.Verdict)
 }
 
+// TestAnalyzeCoverVerdict pins the default verdict of two clean covers. The
+// photo-like cover's R channel is flagged by chi-square, as it was before the
+// rate estimators were added; they must not move either verdict.
+func TestAnalyzeCoverVerdict(t *testing.T) {
+	assert.Equal(t, analysis.VerdictClean, analysis.Analyze(naturalImage(300, 300)).Verdict)
+	res := analysis.Analyze(photoImage(300, 300))
+	assert.Equal(t, analysis.VerdictSuspicious, res.Verdict)
+	assert.Equal(t, analysis.CombineAll.Combine(res.DetectorResults()[:2]), res.Verdict,
+		"the verdict comes from chi-square and RS alone")
+}
+
 func TestAnalyzeFullFill(t *testing.T) {
 	src := naturalImage(500, 500)
 	img := encodeAtFillRate(t, src, 1.0)
@@ -223,6 +462,166 @@ func TestAnalyzeDetectionLimits(t *testing.T) {
 	}
 }
 
+// ── Compare tests ─────────────────────────────────────────────────────────────
+
+func TestCompareIdentical(t *testing.T) {
+	img := naturalImage(64, 48)
+	res, err := analysis.Compare(img, img)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, res.MSE)
+	assert.True(t, math.IsInf(res.PSNR, 1), "PSNR of identical images should be +Inf")
+	assert.InDelta(t, 1.0, res.SSIM, 1e-9)
+	assert.Zero(t, res.ChangedPixels)
+	for _, ch := range res.Channels {
+		assert.Equal(t, map[int]int{0: 64 * 48}, ch.DeltaHist)
+	}
+}
+
+func TestCompareEncoded(t *testing.T) {
+	src := naturalImage(200, 200)
+	res, err := analysis.Compare(src, encodeAtFillRate(t, src, 1.0))
+	require.NoError(t, err)
+
+	// 1 bit per channel changes no sample by more than ±1, and on the all-even
+	// cover every embedded 1 bit is a +1 change.
+	assert.Equal(t, 1, res.MaxAbsDelta)
+	assert.Greater(t, res.PSNR, 50.0)
+	assert.Greater(t, res.SSIM, 0.99)
+	assert.Greater(t, res.ChangedPercent, 50.0)
+	for _, ch := range res.Channels {
+		assert.Equal(t, 200*200, ch.DeltaHist[0]+ch.DeltaHist[1], "channel %s", ch.Channel)
+		assert.Equal(t, ch.DeltaHist[1], ch.Changed)
+		assert.InDelta(t, float64(ch.Changed)/(200*200), ch.MSE, 1e-12)
+	}
+}
+
+func TestCompareSizeMismatch(t *testing.T) {
+	_, err := analysis.Compare(naturalImage(10, 10), naturalImage(10, 11))
+	assert.Error(t, err)
+}
+
+// ── Tiled analysis tests ──────────────────────────────────────────────────────
+
+// halfEmbedded returns src with its left half fully LSB-embedded.
+func halfEmbedded(src *image.RGBA) *image.RGBA {
+	emb := embedLSB(src, 1)
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, src, b.Min, draw.Src)
+	draw.Draw(dst, image.Rect(0, 0, b.Dx()/2, b.Dy()), emb, b.Min, draw.Src)
+	return dst
+}
+
+// TestTilesLocateEmbedding embeds into the left half of a 512×512 image and
+// checks that only tiles in that half are flagged. Chi-square is tested on the
+// all-even image, where clean tiles have p ≈ 0; RS on the photo-like image.
+func TestTilesLocateEmbedding(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   *image.RGBA
+		tiles func(image.Image, analysis.TileOptions) (analysis.TileGrid, error)
+	}{
+		{"chi-square", naturalImage(512, 512), analysis.ChiSquareTiles},
+		{"rs", photoImage(512, 512), analysis.RSTiles},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := tt.tiles(halfEmbedded(tt.src), analysis.TileOptions{Size: 64})
+			require.NoError(t, err)
+			require.Equal(t, 8, g.Cols)
+			require.Equal(t, 8, g.Rows)
+			for row := 0; row < g.Rows; row++ {
+				for col := 0; col < g.Cols; col++ {
+					embedded := col < g.Cols/2
+					assert.Equal(t, embedded, g.At(col, row) > g.Threshold,
+						"tile (%d,%d) score %.4f", col, row, g.At(col, row))
+				}
+			}
+			assert.Equal(t, 32, g.Suspicious())
+		})
+	}
+}
+
+func TestTileGridLayout(t *testing.T) {
+	img := naturalImage(100, 70)
+
+	g, err := analysis.ChiSquareTiles(img, analysis.TileOptions{Size: 32, Stride: 16})
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 16, 32, 48, 64, 68}, g.Xs, "last column flush with the right edge")
+	assert.Equal(t, []int{0, 16, 32, 38}, g.Ys)
+	assert.Len(t, g.Scores, g.Cols*g.Rows)
+
+	for _, opts := range []analysis.TileOptions{{Size: 4}, {Size: 32, Stride: 33}, {Size: 128}} {
+		_, err := analysis.ChiSquareTiles(img, opts)
+		assert.Error(t, err, "options %+v", opts)
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	src := naturalImage(256, 128)
+	g, err := analysis.ChiSquareTiles(halfEmbedded(src), analysis.TileOptions{Size: 64})
+	require.NoError(t, err)
+
+	out, err := analysis.Heatmap(src, g)
+	require.NoError(t, err)
+	assert.Equal(t, src.Bounds(), out.Bounds())
+	hot, cold := out.RGBAAt(10, 10), out.RGBAAt(250, 120)
+	assert.Greater(t, hot.R, cold.R, "embedded half should be redder")
+	assert.Greater(t, cold.G, hot.G, "clean half should be greener")
+
+	_, err = analysis.Heatmap(naturalImage(32, 32), g)
+	assert.Error(t, err, "grid larger than the image")
+}
+
+// ── Visualisation tests ───────────────────────────────────────────────────────
+
+func TestBitPlane(t *testing.T) {
+	src := naturalImage(100, 100)
+
+	clean, err := analysis.BitPlane(src, 0, 0)
+	require.NoError(t, err)
+	for _, v := range clean.Pix {
+		require.Zero(t, v, "every LSB of the all-even cover is 0")
+	}
+
+	encoded, err := analysis.BitPlane(encodeAtFillRate(t, src, 1.0), 0, 0)
+	require.NoError(t, err)
+	set := 0
+	for _, v := range encoded.Pix {
+		if v == 255 {
+			set++
+		}
+	}
+	assert.InDelta(t, 0.5, float64(set)/float64(len(encoded.Pix)), 0.05,
+		"embedded LSB plane should be about half set")
+
+	_, err = analysis.BitPlane(src, 3, 0)
+	assert.Error(t, err)
+	_, err = analysis.BitPlane(src, 0, 8)
+	assert.Error(t, err)
+}
+
+func TestDiffMap(t *testing.T) {
+	src := naturalImage(100, 100)
+	stego := encodeAtFillRate(t, src, 1.0)
+
+	diff, err := analysis.DiffMap(src, stego, 255)
+	require.NoError(t, err)
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			d := diff.RGBAAt(x, y)
+			s := stego.RGBAAt(x, y)
+			// The cover is all-even, so a changed sample is exactly an odd one.
+			assert.Equal(t, (s.R&1)*255, d.R)
+			assert.Equal(t, (s.G&1)*255, d.G)
+			assert.Equal(t, (s.B&1)*255, d.B)
+		}
+	}
+
+	_, err = analysis.DiffMap(src, naturalImage(100, 99), 1)
+	assert.Error(t, err)
+}
+
 // ── Benchmarks ────────────────────────────────────────────────────────────────
 
 func BenchmarkChiSquare(b *testing.B) {
@@ -241,6 +640,22 @@ func BenchmarkRS(b *testing.B) {
 	}
 }
 
+func BenchmarkSPA(b *testing.B) {
+	img := naturalImage(1000, 1000)
+	b.ResetTimer()
+	for b.Loop() {
+		analysis.SPA(img)
+	}
+}
+
+func BenchmarkWS(b *testing.B) {
+	img := naturalImage(1000, 1000)
+	b.ResetTimer()
+	for b.Loop() {
+		analysis.WS(img)
+	}
+}
+
 func BenchmarkAnalyze(b *testing.B) {
 	img := naturalImage(1000, 1000)
 	b.ResetTimer()
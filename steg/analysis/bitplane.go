@@ -0,0 +1,166 @@
+package analysis
+
+import (
+	"fmt"
+	"image"
+)
+
+// planeRateThreshold is the combined rate above which a bit plane is counted
+// as used. Clean planes of photographs estimate below 0.05; planes filled by
+// multi-bit embedding estimate 0.4 or more.
+const planeRateThreshold = 0.2
+
+// BitPlaneResult holds the statistics of one bit plane of a channel.
+//
+// Rate is the mean of the RS, SPA and WS estimates for the plane. Each of them
+// occasionally fails on a fully embedded plane (RS in particular becomes
+// unstable near rate 1), but not all at once. Suspicious is set when Rate
+// exceeds 0.2. The chi-square p-value is reported alongside but does not
+// decide, because on noisy images plane 0 of a clean channel can look as
+// uniform as an embedded one.
+type BitPlaneResult struct {
+	Plane        int     `json:"plane"`
+	ChiSq        float64 `json:"chi_sq"`
+	PValue       float64 `json:"p_value"`
+	RSRate       float64 `json:"rs_rate"`
+	RSConfidence float64 `json:"rs_confidence"`
+	SPARate      float64 `json:"spa_rate"`
+	WSRate       float64 `json:"ws_rate"`
+	Rate         float64 `json:"rate"`
+	Suspicious   bool    `json:"suspicious"`
+}
+
+// BitPlaneChannel holds the per-plane results of one channel and the
+// estimated number of LSB planes carrying data.
+type BitPlaneChannel struct {
+	Channel string           `json:"channel"`
+	Planes  []BitPlaneResult `json:"planes"`
+	// EstimatedPlanes is one more than the highest suspicious plane, since
+	// embedding with n bits per channel always fills planes 0 to n−1.
+	EstimatedPlanes int `json:"estimated_planes"`
+}
+
+// ChiSquarePlane runs the chi-square pairs-of-values test on bit plane plane
+// (0 = LSB) of every channel of img (see imageChannels). Values are compared
+// in pairs that differ only in that bit once the lower planes are discarded,
+// so plane 0 is the ordinary ChiSquare test. It returns an error if plane is
+// beyond the depth of the samples.
+func ChiSquarePlane(img image.Image, plane int) ([]ChiSquareResult, error) {
+	channels := imageChannels(img)
+	if err := validatePlane(channels, plane); err != nil {
+		return nil, err
+	}
+	return mapChannels(channels,
+		func(name string, vals []uint8) ChiSquareResult {
+			return planeChiSquare(name, planeValues(vals, plane), plane)
+		},
+		func(name string, vals []uint16) ChiSquareResult {
+			return planeChiSquare(name, planeValues(vals, plane), plane)
+		},
+	), nil
+}
+
+// RSAnalysisPlane runs RS analysis with DefaultMasks on bit plane plane of
+// every channel of img: the flipping functions act on that bit, with the lower
+// planes discarded so that noise embedded there does not mask the signal.
+// Plane 0 is the ordinary RSAnalysis.
+func RSAnalysisPlane(img image.Image, plane int) ([]RSResult, error) {
+	channels := imageChannels(img)
+	if err := validatePlane(channels, plane); err != nil {
+		return nil, err
+	}
+	w := img.Bounds().Dx()
+	return mapChannels(channels,
+		func(name string, vals []uint8) RSResult {
+			return rangeRS(name, planeValues(vals, plane), ^uint8(0)>>plane, w, DefaultMasks)
+		},
+		func(name string, vals []uint16) RSResult {
+			return rangeRS(name, planeValues(vals, plane), ^uint16(0)>>plane, w, DefaultMasks)
+		},
+	), nil
+}
+
+// BitPlanes runs chi-square, RS, SPA and WS analysis on the lowest planes bit
+// planes of every channel of img and estimates how many of them carry embedded
+// data. planes may be up to 16; channels with 8-bit samples are analysed on at
+// most 8 planes. Use 8, or 16 for 16-bit images, to cover every setting.
+func BitPlanes(img image.Image, planes int) ([]BitPlaneChannel, error) {
+	if planes < 1 || planes > 16 {
+		return nil, fmt.Errorf("planes must be between 1 and 16, got %d", planes)
+	}
+	w := img.Bounds().Dx()
+	return mapChannels(imageChannels(img),
+		func(name string, vals []uint8) BitPlaneChannel { return bitPlaneChannel(name, vals, w, min(planes, 8)) },
+		func(name string, vals []uint16) BitPlaneChannel { return bitPlaneChannel(name, vals, w, planes) },
+	), nil
+}
+
+func bitPlaneChannel[S sample](name string, vals []S, width, planes int) BitPlaneChannel {
+	res := BitPlaneChannel{Channel: name}
+	for p := 0; p < planes; p++ {
+		pv := planeValues(vals, p)
+		chi := planeChiSquare(name, pv, p)
+		rs := rangeRS(name, pv, ^S(0)>>p, width, DefaultMasks)
+		spa := channelSPA(name, pv, width)
+		ws := channelWS(name, pv, width)
+		r := BitPlaneResult{
+			Plane:        p,
+			ChiSq:        chi.ChiSq,
+			PValue:       chi.PValue,
+			RSRate:       rs.Rate,
+			RSConfidence: rs.Confidence,
+			SPARate:      spa.Rate,
+			WSRate:       ws.Rate,
+			Rate:         (rs.Rate + spa.Rate + ws.Rate) / 3,
+		}
+		r.Suspicious = r.Rate > planeRateThreshold
+		if r.Suspicious {
+			res.EstimatedPlanes = p + 1
+		}
+		res.Planes = append(res.Planes, r)
+	}
+	return res
+}
+
+// validatePlane checks that plane exists in every channel.
+func validatePlane(channels []channel, plane int) error {
+	depth := 16
+	for _, c := range channels {
+		depth = min(depth, c.depth())
+	}
+	if plane < 0 || plane >= depth {
+		return fmt.Errorf("bit plane must be between 0 and %d for %d-bit samples, got %d", depth-1, depth, plane)
+	}
+	return nil
+}
+
+// planeValues shifts out the planes below plane, making it the LSB.
+func planeValues[S sample](vals []S, plane int) []S {
+	if plane == 0 {
+		return vals
+	}
+	out := make([]S, len(vals))
+	for i, v := range vals {
+		out[i] = v >> plane
+	}
+	return out
+}
+
+// planeChiSquare is channelChiSquare for values already shifted by
+// planeValues. For 8-bit samples only 128 >> plane pairs can occur, which sets
+// the degrees of freedom. With 16-bit samples most of the possible pairs are
+// empty in any real image, so the pairs that do occur set them instead.
+func planeChiSquare[S sample](name string, vals []S, plane int) ChiSquareResult {
+	chiSq, pairs := chiSquareStat(vals)
+	df := ((int(^S(0))+1)/2)>>plane - 1
+	if uint64(^S(0)) > 0xff {
+		df = pairs - 1
+	}
+	p := chi2PValue(chiSq, max(1, df))
+	return ChiSquareResult{
+		Channel:    name,
+		ChiSq:      chiSq,
+		PValue:     p,
+		Suspicious: p > 0.05,
+	}
+}
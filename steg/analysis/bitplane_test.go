@@ -0,0 +1,121 @@
+package analysis_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/pableeee/steg/steg"
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeBits fills src to capacity using bpc bits of the R and G channels,
+// leaving B untouched.
+func encodeBits(t *testing.T, src *image.RGBA, bpc int) *image.RGBA {
+	t.Helper()
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	b := src.Bounds()
+	size := b.Dx()*b.Dy()*2*bpc/8 - 56
+	require.NoError(t, steg.Encode(dst, []byte("planepass"), bytes.NewReader(make([]byte, size)), bpc, 2))
+	return dst
+}
+
+func TestBitPlanesEstimate(t *testing.T) {
+	src := photoImage(256, 256)
+
+	clean, err := analysis.BitPlanes(src, 8)
+	require.NoError(t, err)
+	for _, c := range clean {
+		assert.Len(t, c.Planes, 8)
+		assert.Equal(t, 0, c.EstimatedPlanes, "channel %s of the cover", c.Channel)
+	}
+
+	for _, bpc := range []int{1, 2, 4, 8} {
+		t.Run(fmt.Sprintf("bpc=%d", bpc), func(t *testing.T) {
+			res, err := analysis.BitPlanes(encodeBits(t, src, bpc), 8)
+			require.NoError(t, err)
+			assert.Equal(t, bpc, res[0].EstimatedPlanes, "R")
+			assert.Equal(t, bpc, res[1].EstimatedPlanes, "G")
+			assert.Equal(t, 0, res[2].EstimatedPlanes, "B is not used")
+		})
+	}
+}
+
+// TestBitPlaneZero checks that plane 0 reproduces the whole-value tests.
+func TestBitPlaneZero(t *testing.T) {
+	img := encodeBits(t, photoImage(128, 128), 1)
+
+	chi, err := analysis.ChiSquarePlane(img, 0)
+	require.NoError(t, err)
+	assert.Equal(t, analysis.ChiSquare(img), chi)
+
+	rs, err := analysis.RSAnalysisPlane(img, 0)
+	require.NoError(t, err)
+	assert.Equal(t, analysis.RSAnalysis(img), rs)
+}
+
+// TestBitPlaneHigherPlanes checks that embedding in two planes shows up in the
+// plane-1 tests but not in plane 2.
+func TestBitPlaneHigherPlanes(t *testing.T) {
+	cover := photoImage(256, 256)
+	img := encodeBits(t, cover, 2)
+
+	chi, err := analysis.ChiSquarePlane(img, 1)
+	require.NoError(t, err)
+	assert.True(t, chi[0].Suspicious, "R plane 1 is filled")
+	assert.False(t, chi[2].Suspicious, "B is not used")
+
+	chi, err = analysis.ChiSquarePlane(img, 2)
+	require.NoError(t, err)
+	assert.False(t, chi[0].Suspicious, "R plane 2 is not used")
+
+	// RS is unstable on fully embedded planes, so measure it at rate 0.5:
+	// randomise the two low bits of half the R samples.
+	half := image.NewRGBA(cover.Bounds())
+	copy(half.Pix, cover.Pix)
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < len(half.Pix); i += 4 {
+		if rng.Intn(2) == 0 {
+			half.Pix[i] = half.Pix[i]&^3 | uint8(rng.Intn(4))
+		}
+	}
+	rs, err := analysis.RSAnalysisPlane(half, 1)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, rs[0].Rate, 0.15, "R plane 1")
+
+	rs, err = analysis.RSAnalysisPlane(cover, 1)
+	require.NoError(t, err)
+	assert.Less(t, rs[0].Rate, 0.1, "clean plane 1")
+}
+
+// TestFlipNegRange checks that the negative flipping function stays within
+// the range of the shifted plane values, swapping 0 with its top.
+func TestFlipNegRange(t *testing.T) {
+	for plane := 0; plane < 8; plane++ {
+		top := uint8(0xff) >> plane
+		assert.Equal(t, top, analysis.FlipNeg(0, top), "plane %d", plane)
+		assert.Equal(t, uint8(0), analysis.FlipNeg(top, top), "plane %d", plane)
+		for x := 0; x <= int(top); x++ {
+			y := analysis.FlipNeg(uint8(x), top)
+			assert.LessOrEqual(t, y, top, "plane %d: %d", plane, x)
+			assert.Equal(t, uint8(x), analysis.FlipNeg(y, top), "plane %d: %d", plane, x)
+		}
+	}
+}
+
+func TestBitPlaneInvalid(t *testing.T) {
+	img := naturalImage(16, 16)
+	_, err := analysis.ChiSquarePlane(img, 8)
+	assert.Error(t, err)
+	_, err = analysis.RSAnalysisPlane(img, -1)
+	assert.Error(t, err)
+	_, err = analysis.BitPlanes(img, 0)
+	assert.Error(t, err)
+	_, err = analysis.BitPlanes(img, 17)
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package analysis_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// channelNames returns the channel names of a set of SPA results.
+func channelNames(res []analysis.SPAResult) []string {
+	var names []string
+	for _, r := range res {
+		names = append(names, r.Channel)
+	}
+	return names
+}
+
+// grayImage returns the R channel of photoImage as an 8-bit grayscale image.
+func grayImage(w, h int) *image.Gray {
+	src := photoImage(w, h)
+	img := image.NewGray(src.Bounds())
+	for i := range img.Pix {
+		img.Pix[i] = src.Pix[4*i]
+	}
+	return img
+}
+
+// photo16 returns the content of photoImage as 16-bit samples: a low-contrast
+// image in which, as in an 8-bit photograph, neighbouring samples are close
+// enough for the pair and prediction statistics to work.
+func photo16(w, h int) *image.RGBA64 {
+	rng := rand.New(rand.NewSource(4))
+	clamp := func(v float64) uint16 { return uint16(math.Round(math.Max(0, math.Min(65535, v)))) }
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			fx, fy := float64(x), float64(y)
+			base := 40*math.Sin(fx/23)*math.Cos(fy/31) + 30*math.Sin((fx+fy)/57) + 20*math.Cos(fx/11-fy/17)
+			img.SetRGBA64(x, y, color.RGBA64{
+				R: clamp(30000 + base + rng.NormFloat64()*2),
+				G: clamp(20000 + base*0.8 + rng.NormFloat64()*2),
+				B: clamp(10000 + base*0.6 + rng.NormFloat64()*2),
+				A: 0xffff,
+			})
+		}
+	}
+	return img
+}
+
+func TestGrayscaleSingleChannel(t *testing.T) {
+	gray := grayImage(200, 200)
+	res := analysis.Analyze(gray)
+	assert.Equal(t, []string{"Y"}, channelNames(res.SPA))
+	require.Len(t, res.ChiSquare, 1)
+	require.Len(t, res.RS, 1)
+	require.Len(t, res.WS, 1)
+	assert.Less(t, res.SPA[0].Rate, 0.1)
+
+	stego := image.NewGray(gray.Bounds())
+	rng := rand.New(rand.NewSource(5))
+	for i, v := range gray.Pix {
+		stego.Pix[i] = v&^1 | uint8(rng.Intn(2))
+	}
+	res = analysis.Analyze(stego)
+	assert.Greater(t, res.SPA[0].Rate, 0.8)
+	assert.Greater(t, res.WS[0].Rate, 0.8)
+
+	// A colour image whose channels are all equal is grayscale too.
+	rgb := image.NewRGBA(gray.Bounds())
+	for i, v := range gray.Pix {
+		rgb.Pix[4*i], rgb.Pix[4*i+1], rgb.Pix[4*i+2], rgb.Pix[4*i+3] = v, v, v, 255
+	}
+	assert.Equal(t, []string{"Y"}, channelNames(analysis.SPA(rgb)))
+	assert.Equal(t, analysis.SPA(gray), analysis.SPA(rgb))
+}
+
+func TestAlphaChannel(t *testing.T) {
+	src := photoImage(200, 200)
+	assert.Equal(t, []string{"R", "G", "B"}, channelNames(analysis.SPA(src)), "opaque alpha is skipped")
+
+	// Alpha follows the image content; embed random bits in its LSB only.
+	img := image.NewNRGBA(src.Bounds())
+	copy(img.Pix, src.Pix)
+	rng := rand.New(rand.NewSource(6))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = (img.Pix[i-3]/2+100)&^1 | uint8(rng.Intn(2))
+	}
+	res := analysis.SPA(img)
+	require.Equal(t, []string{"R", "G", "B", "A"}, channelNames(res))
+	assert.Greater(t, res[3].Rate, 0.8, "A carries the embedding")
+
+	// Translucent NRGBA samples are analysed as stored, not premultiplied:
+	// R, G and B read exactly as in the opaque source.
+	opaque := analysis.SPA(src)
+	for i := range opaque {
+		assert.Equal(t, opaque[i], res[i])
+	}
+}
+
+func TestSixteenBit(t *testing.T) {
+	src := photo16(200, 200)
+	clean := analysis.Analyze(src)
+	require.Equal(t, []string{"R", "G", "B"}, channelNames(clean.SPA))
+
+	// Randomise the native LSB of every sample; the top byte, which is all an
+	// 8-bit view sees, does not change.
+	stego := image.NewRGBA64(src.Bounds())
+	copy(stego.Pix, src.Pix)
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < len(stego.Pix); i += 8 {
+		for c := 0; c < 3; c++ {
+			stego.Pix[i+2*c+1] = stego.Pix[i+2*c+1]&^1 | uint8(rng.Intn(2))
+		}
+	}
+	res := analysis.Analyze(stego)
+	for i := range res.SPA {
+		assert.Less(t, clean.SPA[i].Rate, 0.1, "clean %s", clean.SPA[i].Channel)
+		assert.Less(t, clean.WS[i].Rate, 0.1, "clean %s", clean.WS[i].Channel)
+		assert.Greater(t, res.SPA[i].Rate, 0.8, "stego %s", res.SPA[i].Channel)
+		assert.Greater(t, res.WS[i].Rate, 0.8, "stego %s", res.WS[i].Channel)
+	}
+
+	planes, err := analysis.BitPlanes(stego, 16)
+	require.NoError(t, err)
+	for _, c := range planes {
+		assert.Len(t, c.Planes, 16)
+		assert.Equal(t, 1, c.EstimatedPlanes, "channel %s", c.Channel)
+	}
+	_, err = analysis.ChiSquarePlane(stego, 15)
+	assert.NoError(t, err, "16-bit samples have 16 planes")
+	_, err = analysis.ChiSquarePlane(src, 16)
+	assert.Error(t, err)
+
+	// Gray16 is a single 16-bit channel.
+	gray := image.NewGray16(src.Bounds())
+	for i := 0; i < len(gray.Pix); i += 2 {
+		gray.Pix[i], gray.Pix[i+1] = src.Pix[4*i], src.Pix[4*i+1]
+	}
+	assert.Equal(t, []string{"Y"}, channelNames(analysis.SPA(gray)))
+}
@@ -5,44 +5,43 @@ import (
 	"math"
 )
 
-// ChiSquare runs the chi-square pairs-of-values test on all three channels of
-// img. For each channel, pixel value pairs (2k, 2k+1) should be approximately
-// equal in frequency after LSB embedding; natural images have unequal pairs.
+// ChiSquare runs the chi-square pairs-of-values test on every channel of img
+// (see imageChannels). For each channel, sample value pairs (2k, 2k+1) should
+// be approximately equal in frequency after LSB embedding; natural images have
+// unequal pairs.
 //
 // A high p-value (> 0.05) is suspicious — the distribution is too uniform.
 func ChiSquare(img image.Image) []ChiSquareResult {
-	names := []string{"R", "G", "B"}
-	results := make([]ChiSquareResult, 3)
-	for ch := 0; ch < 3; ch++ {
-		results[ch] = channelChiSquare(names[ch], extractChannel(img, ch))
-	}
-	return results
+	return chiSquareChannels(imageChannels(img))
+}
+
+func chiSquareChannels(channels []channel) []ChiSquareResult {
+	return mapChannels(channels, channelChiSquare[uint8], channelChiSquare[uint16])
 }
 
-func channelChiSquare(name string, vals []uint8) ChiSquareResult {
-	var hist [256]float64
+func channelChiSquare[S sample](name string, vals []S) ChiSquareResult {
+	return planeChiSquare(name, vals, 0)
+}
+
+// chiSquareStat returns the pairs-of-values statistic for vals and the number
+// of pairs (2k, 2k+1) that occur at all.
+func chiSquareStat[S sample](vals []S) (chiSq float64, pairs int) {
+	hist := make([]float64, int(^S(0))+1)
 	for _, v := range vals {
 		hist[v]++
 	}
 
-	var chiSq float64
-	for k := 0; k < 128; k++ {
+	for k := 0; k < len(hist)/2; k++ {
 		e := (hist[2*k] + hist[2*k+1]) / 2
 		if e == 0 {
 			continue
 		}
+		pairs++
 		d0 := hist[2*k] - e
 		d1 := hist[2*k+1] - e
 		chiSq += (d0*d0 + d1*d1) / e
 	}
-
-	p := chi2PValue(chiSq, 127)
-	return ChiSquareResult{
-		Channel:    name,
-		ChiSq:      chiSq,
-		PValue:     p,
-		Suspicious: p > 0.05,
-	}
+	return chiSq, pairs
 }
 
 // chi2PValue returns P(X ≥ chiSq) for a chi-squared distribution with df
@@ -0,0 +1,240 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// Model is a Fisher linear discriminant over the ExtractFeatures vector. An
+// image's projection w·x + Bias is positive on the stego side; Score maps it
+// through a logistic curve scaled by the spread of the training projections.
+//
+// A Model is a Detector named "model". It is not registered by default since
+// it has to be trained first; load one with LoadModel.
+type Model struct {
+	Features string    `json:"features"` // FeatureSet the model was trained on
+	Weights  []float64 `json:"weights"`
+	Bias     float64   `json:"bias"`
+	Scale    float64   `json:"scale"` // pooled standard deviation of the projections
+
+	TrainCovers   int     `json:"train_covers"`
+	TrainStego    int     `json:"train_stego"`
+	TrainAccuracy float64 `json:"train_accuracy"`
+}
+
+// DefaultRegularization is the TrainLDA regularization used by steg train.
+const DefaultRegularization = 0.1
+
+// TrainLDA fits a Fisher linear discriminant separating cover from stego
+// feature vectors. regularization is added to the diagonal of the within-class
+// scatter, relative to its mean diagonal entry, so the system stays solvable
+// when there are fewer images than features. Small training sets overfit
+// easily; DefaultRegularization is a good starting point.
+func TrainLDA(cover, stego [][]float64, regularization float64) (*Model, error) {
+	if len(cover) < 2 || len(stego) < 2 {
+		return nil, fmt.Errorf("need at least two cover and two stego images, got %d and %d", len(cover), len(stego))
+	}
+	dim := len(cover[0])
+	for _, set := range [][][]float64{cover, stego} {
+		for _, x := range set {
+			if len(x) != dim {
+				return nil, fmt.Errorf("feature vectors have different lengths: %d and %d", dim, len(x))
+			}
+		}
+	}
+
+	mc, ms := mean(cover, dim), mean(stego, dim)
+
+	// Within-class scatter, regularised: S = Σ (x−μ)(x−μ)ᵀ + λ·tr(S)/dim·I.
+	s := make([]float64, dim*dim)
+	for _, pair := range []struct {
+		set [][]float64
+		mu  []float64
+	}{{cover, mc}, {stego, ms}} {
+		d := make([]float64, dim)
+		for _, x := range pair.set {
+			for i := range d {
+				d[i] = x[i] - pair.mu[i]
+			}
+			for i := 0; i < dim; i++ {
+				if d[i] == 0 {
+					continue
+				}
+				row := s[i*dim:]
+				for j := 0; j <= i; j++ {
+					row[j] += d[i] * d[j]
+				}
+			}
+		}
+	}
+	var trace float64
+	for i := 0; i < dim; i++ {
+		trace += s[i*dim+i]
+	}
+	ridge := regularization * trace / float64(dim)
+	if ridge <= 0 {
+		ridge = 1e-12
+	}
+	for i := 0; i < dim; i++ {
+		s[i*dim+i] += ridge
+	}
+
+	diff := make([]float64, dim)
+	for i := range diff {
+		diff[i] = ms[i] - mc[i]
+	}
+	w, err := choleskySolve(s, diff, dim)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Model{Features: FeatureSet, Weights: w, Scale: 1, TrainCovers: len(cover), TrainStego: len(stego)}
+	pc, ps := m.projectAll(cover), m.projectAll(stego)
+	meanC, varC := meanVar(pc)
+	meanS, varS := meanVar(ps)
+	m.Bias = -(meanC + meanS) / 2
+	if sd := math.Sqrt((varC + varS) / 2); sd > 0 {
+		m.Scale = sd
+	}
+
+	correct := 0
+	for _, p := range pc {
+		if p+m.Bias <= 0 {
+			correct++
+		}
+	}
+	for _, p := range ps {
+		if p+m.Bias > 0 {
+			correct++
+		}
+	}
+	m.TrainAccuracy = float64(correct) / float64(len(pc)+len(ps))
+	return m, nil
+}
+
+// Name returns "model".
+func (m *Model) Name() string { return "model" }
+
+// Detect scores img as a whole. The single ChannelScore is named "RGB"; its
+// Score is the probability-like output of Score, Confidence is how far that is
+// from the 0.5 decision boundary, and Suspicious is Score > 0.5.
+func (m *Model) Detect(img image.Image) []ChannelScore {
+	p := m.Score(ExtractFeatures(img))
+	return []ChannelScore{{Channel: "RGB", Score: p, Confidence: math.Abs(2*p - 1), Suspicious: p > 0.5}}
+}
+
+// Score returns a value in (0, 1) for a feature vector: above 0.5 is on the
+// stego side of the discriminant.
+func (m *Model) Score(features []float64) float64 {
+	z := (m.project(features) + m.Bias) / m.Scale
+	return 1 / (1 + math.Exp(-z))
+}
+
+func (m *Model) project(x []float64) float64 {
+	var p float64
+	for i, w := range m.Weights {
+		p += w * x[i]
+	}
+	return p
+}
+
+func (m *Model) projectAll(set [][]float64) []float64 {
+	out := make([]float64, len(set))
+	for i, x := range set {
+		out[i] = m.project(x)
+	}
+	return out
+}
+
+// Save writes m as JSON.
+func (m *Model) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// LoadModel reads a model written by Save and checks that it matches the
+// current feature set.
+func LoadModel(r io.Reader) (*Model, error) {
+	var m Model
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid model file: %w", err)
+	}
+	if m.Features != FeatureSet {
+		return nil, fmt.Errorf("model was trained on features %q, this build extracts %q", m.Features, FeatureSet)
+	}
+	if len(m.Weights) != FeatureDim {
+		return nil, fmt.Errorf("model has %d weights, expected %d", len(m.Weights), FeatureDim)
+	}
+	if m.Scale <= 0 {
+		return nil, fmt.Errorf("model scale must be positive, got %g", m.Scale)
+	}
+	return &m, nil
+}
+
+func mean(set [][]float64, dim int) []float64 {
+	mu := make([]float64, dim)
+	for _, x := range set {
+		for i, v := range x {
+			mu[i] += v
+		}
+	}
+	for i := range mu {
+		mu[i] /= float64(len(set))
+	}
+	return mu
+}
+
+func meanVar(v []float64) (mean, variance float64) {
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	for _, x := range v {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(v))
+}
+
+// choleskySolve solves a·x = b for a symmetric positive-definite n×n matrix of
+// which only the lower triangle (row-major) is read. a is overwritten.
+func choleskySolve(a, b []float64, n int) ([]float64, error) {
+	for j := 0; j < n; j++ {
+		d := a[j*n+j]
+		for k := 0; k < j; k++ {
+			d -= a[j*n+k] * a[j*n+k]
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("scatter matrix is not positive definite; increase regularization")
+		}
+		d = math.Sqrt(d)
+		a[j*n+j] = d
+		for i := j + 1; i < n; i++ {
+			v := a[i*n+j]
+			for k := 0; k < j; k++ {
+				v -= a[i*n+k] * a[j*n+k]
+			}
+			a[i*n+j] = v / d
+		}
+	}
+
+	// Forward substitution L·y = b, then back substitution Lᵀ·x = y.
+	x := make([]float64, n)
+	copy(x, b)
+	for i := 0; i < n; i++ {
+		for k := 0; k < i; k++ {
+			x[i] -= a[i*n+k] * x[k]
+		}
+		x[i] /= a[i*n+i]
+	}
+	for i := n - 1; i >= 0; i-- {
+		for k := i + 1; k < n; k++ {
+			x[i] -= a[k*n+i] * x[k]
+		}
+		x[i] /= a[i*n+i]
+	}
+	return x, nil
+}
@@ -0,0 +1,97 @@
+package analysis_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFeatures(t *testing.T) {
+	f := analysis.ExtractFeatures(photoImage(64, 64))
+	require.Len(t, f, analysis.FeatureDim)
+	for k := 0; k < 4; k++ {
+		var sum float64
+		for _, v := range f[k*analysis.FeatureDim/4 : (k+1)*analysis.FeatureDim/4] {
+			assert.GreaterOrEqual(t, v, 0.0)
+			sum += v
+		}
+		assert.InDelta(t, 1.0, sum, 1e-9, "each residual histogram is normalised")
+	}
+}
+
+// TestTrainLDA trains on one set of photo-like images and checks that the
+// model separates cover from low-rate stego on images it has not seen.
+func TestTrainLDA(t *testing.T) {
+	const rate = 0.2
+	features := func(seeds []int64, stego bool) [][]float64 {
+		var out [][]float64
+		for _, s := range seeds {
+			img := photoImageSeed(96, 96, s)
+			if stego {
+				img = embedLSB(img, rate)
+			}
+			out = append(out, analysis.ExtractFeatures(img))
+		}
+		return out
+	}
+	var train, test []int64
+	for s := int64(1); s <= 40; s++ {
+		if s%4 == 0 {
+			test = append(test, s)
+		} else {
+			train = append(train, s)
+		}
+	}
+
+	m, err := analysis.TrainLDA(features(train, false), features(train, true), analysis.DefaultRegularization)
+	require.NoError(t, err)
+	assert.Equal(t, analysis.FeatureSet, m.Features)
+	assert.Greater(t, m.TrainAccuracy, 0.9)
+
+	var cover, stego []float64
+	for _, x := range features(test, false) {
+		cover = append(cover, m.Score(x))
+	}
+	for _, x := range features(test, true) {
+		stego = append(stego, m.Score(x))
+	}
+	assert.Greater(t, analysis.AUC(analysis.ROC(cover, stego)), 0.9)
+
+	scores := m.Detect(embedLSB(photoImageSeed(96, 96, 100), rate))
+	require.Len(t, scores, 1)
+	assert.True(t, scores[0].Suspicious)
+
+	t.Run("save and load", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, m.Save(&buf))
+		loaded, err := analysis.LoadModel(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, m, loaded)
+	})
+}
+
+func TestTrainLDAErrors(t *testing.T) {
+	x := make([]float64, 3)
+	_, err := analysis.TrainLDA([][]float64{x}, [][]float64{x, x}, 1e-3)
+	assert.Error(t, err, "too few covers")
+	_, err = analysis.TrainLDA([][]float64{x, x}, [][]float64{x, make([]float64, 2)}, 1e-3)
+	assert.Error(t, err, "mismatched lengths")
+}
+
+func TestLoadModelErrors(t *testing.T) {
+	for name, in := range map[string]string{
+		"not json":    "{",
+		"feature set": `{"features": "other", "scale": 1}`,
+		"weights":     `{"features": "` + analysis.FeatureSet + `", "weights": [1], "scale": 1}`,
+		"zero scale":  `{"features": "` + analysis.FeatureSet + `", "weights": [` + strings.Repeat("0,", analysis.FeatureDim-1) + `0]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := analysis.LoadModel(strings.NewReader(in))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package analysis
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// ChannelDistortion holds the cover-vs-stego distortion metrics for one channel.
+type ChannelDistortion struct {
+	Channel     string      `json:"channel"`
+	MSE         float64     `json:"mse"`
+	PSNR        float64     `json:"psnr"`    // dB against a peak of 255; +Inf when the channel is unchanged
+	SSIM        float64     `json:"ssim"`    // mean SSIM over 8×8 windows; 1 = identical
+	Changed     int         `json:"changed"` // pixels whose value differs in this channel
+	MaxAbsDelta int         `json:"max_abs_delta"`
+	DeltaHist   map[int]int `json:"delta_hist"` // stego − cover → pixel count; zero counts omitted
+}
+
+// CompareResult is the distortion report for a cover/stego pair.
+type CompareResult struct {
+	Width          int                 `json:"width"`
+	Height         int                 `json:"height"`
+	Channels       []ChannelDistortion `json:"channels"`
+	MSE            float64             `json:"mse"`            // mean over R, G and B
+	PSNR           float64             `json:"psnr"`           // from the mean MSE; +Inf when the images are identical
+	SSIM           float64             `json:"ssim"`           // mean of the per-channel SSIM values
+	ChangedPixels  int                 `json:"changed_pixels"` // pixels that differ in at least one channel
+	ChangedPercent float64             `json:"changed_percent"`
+	MaxAbsDelta    int                 `json:"max_abs_delta"`
+}
+
+// Compare measures how far stego departs from cover. Both images must have the
+// same dimensions; only the R, G and B channels are compared.
+func Compare(cover, stego image.Image) (CompareResult, error) {
+	cb, sb := cover.Bounds(), stego.Bounds()
+	if cb.Dx() != sb.Dx() || cb.Dy() != sb.Dy() {
+		return CompareResult{}, fmt.Errorf("image sizes differ: %dx%d vs %dx%d", cb.Dx(), cb.Dy(), sb.Dx(), sb.Dy())
+	}
+	w, h := cb.Dx(), cb.Dy()
+	res := CompareResult{Width: w, Height: h}
+
+	names := []string{"R", "G", "B"}
+	changed := make([]bool, w*h)
+	for ch := 0; ch < 3; ch++ {
+		c := extractChannel(cover, ch)
+		s := extractChannel(stego, ch)
+		d := channelDistortion(names[ch], c, s, w, h)
+		for i := range c {
+			if c[i] != s[i] {
+				changed[i] = true
+			}
+		}
+		res.Channels = append(res.Channels, d)
+		res.MSE += d.MSE / 3
+		res.SSIM += d.SSIM / 3
+		if d.MaxAbsDelta > res.MaxAbsDelta {
+			res.MaxAbsDelta = d.MaxAbsDelta
+		}
+	}
+
+	for _, c := range changed {
+		if c {
+			res.ChangedPixels++
+		}
+	}
+	if w*h > 0 {
+		res.ChangedPercent = 100 * float64(res.ChangedPixels) / float64(w*h)
+	}
+	res.PSNR = psnr(res.MSE)
+	return res, nil
+}
+
+func channelDistortion(name string, cover, stego []uint8, w, h int) ChannelDistortion {
+	d := ChannelDistortion{Channel: name, DeltaHist: map[int]int{}}
+	var sqSum float64
+	for i := range cover {
+		delta := int(stego[i]) - int(cover[i])
+		d.DeltaHist[delta]++
+		if delta == 0 {
+			continue
+		}
+		d.Changed++
+		sqSum += float64(delta * delta)
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta > d.MaxAbsDelta {
+			d.MaxAbsDelta = delta
+		}
+	}
+	if len(cover) > 0 {
+		d.MSE = sqSum / float64(len(cover))
+	}
+	d.PSNR = psnr(d.MSE)
+	d.SSIM = ssim(cover, stego, w, h)
+	return d
+}
+
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// ssimWindow is the side of the square window SSIM is averaged over.
+const ssimWindow = 8
+
+// ssim returns the mean structural similarity of x and y over every 8×8
+// window (stride 1), using the constants from Wang et al. (2004). Window sums
+// come from summed-area tables, so the cost is linear in the pixel count.
+// Images smaller than the window are treated as a single window.
+func ssim(x, y []uint8, w, h int) float64 {
+	if w == 0 || h == 0 {
+		return 1
+	}
+	win := ssimWindow
+	if w < win || h < win {
+		return ssimStats(x, y, 0, 0, w, h, w)
+	}
+
+	// Summed-area tables with a zero row and column, (w+1)×(h+1).
+	sw := w + 1
+	sx := make([]float64, sw*(h+1))
+	sy := make([]float64, sw*(h+1))
+	sxx := make([]float64, sw*(h+1))
+	syy := make([]float64, sw*(h+1))
+	sxy := make([]float64, sw*(h+1))
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			a, b := float64(x[j*w+i]), float64(y[j*w+i])
+			k := (j+1)*sw + i + 1
+			up, left, diag := k-sw, k-1, k-sw-1
+			sx[k] = a + sx[up] + sx[left] - sx[diag]
+			sy[k] = b + sy[up] + sy[left] - sy[diag]
+			sxx[k] = a*a + sxx[up] + sxx[left] - sxx[diag]
+			syy[k] = b*b + syy[up] + syy[left] - syy[diag]
+			sxy[k] = a*b + sxy[up] + sxy[left] - sxy[diag]
+		}
+	}
+	box := func(t []float64, i, j int) float64 {
+		return t[(j+win)*sw+i+win] - t[j*sw+i+win] - t[(j+win)*sw+i] + t[j*sw+i]
+	}
+
+	n := float64(win * win)
+	var total float64
+	count := 0
+	for j := 0; j+win <= h; j++ {
+		for i := 0; i+win <= w; i++ {
+			total += ssimFormula(box(sx, i, j), box(sy, i, j), box(sxx, i, j), box(syy, i, j), box(sxy, i, j), n)
+			count++
+		}
+	}
+	return total / float64(count)
+}
+
+// ssimStats computes SSIM over the single w×h block at (x0, y0) directly.
+func ssimStats(x, y []uint8, x0, y0, w, h, stride int) float64 {
+	var sx, sy, sxx, syy, sxy float64
+	for j := y0; j < y0+h; j++ {
+		for i := x0; i < x0+w; i++ {
+			a, b := float64(x[j*stride+i]), float64(y[j*stride+i])
+			sx += a
+			sy += b
+			sxx += a * a
+			syy += b * b
+			sxy += a * b
+		}
+	}
+	return ssimFormula(sx, sy, sxx, syy, sxy, float64(w*h))
+}
+
+func ssimFormula(sx, sy, sxx, syy, sxy, n float64) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	mx, my := sx/n, sy/n
+	vx := sxx/n - mx*mx
+	vy := syy/n - my*my
+	cov := sxy/n - mx*my
+	return ((2*mx*my + c1) * (2*cov + c2)) / ((mx*mx + my*my + c1) * (vx + vy + c2))
+}
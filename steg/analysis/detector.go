@@ -0,0 +1,262 @@
+package analysis
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+)
+
+// ChannelScore is a detector's finding for one channel. Score is in [0,1] and
+// grows with the evidence for embedding; its meaning is detector-specific (a
+// p-value for chi-square, an estimated embedding rate for RS, SPA and WS).
+// Confidence, also in [0,1], is how far the detector trusts its own score.
+type ChannelScore struct {
+	Channel    string  `json:"channel"`
+	Score      float64 `json:"score"`
+	Confidence float64 `json:"confidence"`
+	Suspicious bool    `json:"suspicious"`
+}
+
+// Detector is a steganalysis test that can be registered and combined with
+// others. Detect must be safe for concurrent use.
+type Detector interface {
+	Name() string
+	Detect(img image.Image) []ChannelScore
+}
+
+// DetectorResult is the output of one detector on one image.
+type DetectorResult struct {
+	Detector string         `json:"detector"`
+	Channels []ChannelScore `json:"channels"`
+}
+
+// Report is the output of Run: every detector's result and the combined
+// verdict.
+type Report struct {
+	Detectors []DetectorResult `json:"detectors"`
+	Verdict   string           `json:"verdict"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Detector{}
+)
+
+// Register makes d available by name to Lookup and RegisteredDetectors. As
+// with image.RegisterFormat it is meant to be called from init functions, and
+// it panics if the name is empty or already taken.
+func Register(d Detector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name := d.Name()
+	if name == "" {
+		panic("analysis: Register detector with empty name")
+	}
+	if _, dup := registry[name]; dup {
+		panic("analysis: Register called twice for detector " + name)
+	}
+	registry[name] = d
+}
+
+// unregister removes the detector called name, so that tests can register
+// their own without leaking them into later runs.
+func unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, name)
+}
+
+// Lookup returns the registered detector called name.
+func Lookup(name string) (Detector, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	d, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown detector %q", name)
+	}
+	return d, nil
+}
+
+// RegisteredDetectors returns the names of all registered detectors, sorted.
+func RegisteredDetectors() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs each detector on img and combines their results with c.
+func Run(img image.Image, detectors []Detector, c Combiner) Report {
+	rep := Report{Detectors: make([]DetectorResult, len(detectors))}
+	for i, d := range detectors {
+		rep.Detectors[i] = DetectorResult{Detector: d.Name(), Channels: d.Detect(img)}
+	}
+	rep.Verdict = c.Combine(rep.Detectors)
+	return rep
+}
+
+// Combiner turns the results of several detectors into a verdict: one of
+// VerdictClean, VerdictSuspicious or VerdictLikelyStego.
+type Combiner interface {
+	Combine(results []DetectorResult) string
+}
+
+// CombinerFunc adapts a function to the Combiner interface.
+type CombinerFunc func(results []DetectorResult) string
+
+// Combine calls f(results).
+func (f CombinerFunc) Combine(results []DetectorResult) string { return f(results) }
+
+var (
+	// CombineAll is the rule Analyze uses: CLEAN when no channel of any
+	// detector is suspicious, LIKELY_STEGO when every one is, SUSPICIOUS
+	// otherwise.
+	CombineAll Combiner = CombinerFunc(combineAll)
+
+	// CombineAny reports LIKELY_STEGO as soon as one detector flags any
+	// channel, and CLEAN otherwise.
+	CombineAny Combiner = CombinerFunc(combineAny)
+
+	// CombineMajority reports LIKELY_STEGO when more than half of the
+	// detectors flag at least one channel, SUSPICIOUS when fewer do, and
+	// CLEAN when none do.
+	CombineMajority Combiner = CombinerFunc(combineMajority)
+)
+
+// CombineWeighted scores each detector by the highest Confidence among its
+// suspicious channels (0 if none is suspicious) and averages the scores with
+// the given weights; detectors missing from weights get weight 1. An average
+// of at least 0.5 is LIKELY_STEGO, any positive average SUSPICIOUS.
+func CombineWeighted(weights map[string]float64) Combiner {
+	return CombinerFunc(func(results []DetectorResult) string {
+		var sum, total float64
+		for _, r := range results {
+			w, ok := weights[r.Detector]
+			if !ok {
+				w = 1
+			}
+			vote := 0.0
+			for _, c := range r.Channels {
+				if c.Suspicious {
+					vote = max(vote, c.Confidence)
+				}
+			}
+			sum += w * vote
+			total += w
+		}
+		switch {
+		case total <= 0 || sum <= 0:
+			return VerdictClean
+		case sum/total >= 0.5:
+			return VerdictLikelyStego
+		default:
+			return VerdictSuspicious
+		}
+	})
+}
+
+func combineAll(results []DetectorResult) string {
+	hits, total := 0, 0
+	for _, r := range results {
+		for _, c := range r.Channels {
+			total++
+			if c.Suspicious {
+				hits++
+			}
+		}
+	}
+	switch {
+	case hits == 0:
+		return VerdictClean
+	case hits < total:
+		return VerdictSuspicious
+	default:
+		return VerdictLikelyStego
+	}
+}
+
+func combineAny(results []DetectorResult) string {
+	if flaggingDetectors(results) > 0 {
+		return VerdictLikelyStego
+	}
+	return VerdictClean
+}
+
+func combineMajority(results []DetectorResult) string {
+	n := flaggingDetectors(results)
+	switch {
+	case n == 0:
+		return VerdictClean
+	case 2*n > len(results):
+		return VerdictLikelyStego
+	default:
+		return VerdictSuspicious
+	}
+}
+
+// flaggingDetectors counts the results with at least one suspicious channel.
+func flaggingDetectors(results []DetectorResult) int {
+	n := 0
+	for _, r := range results {
+		for _, c := range r.Channels {
+			if c.Suspicious {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// detectorFunc adapts the built-in tests to the Detector interface.
+type detectorFunc struct {
+	name   string
+	detect func(image.Image) []ChannelScore
+}
+
+func (d detectorFunc) Name() string                          { return d.name }
+func (d detectorFunc) Detect(img image.Image) []ChannelScore { return d.detect(img) }
+
+func init() {
+	Register(detectorFunc{"chi-square", func(img image.Image) []ChannelScore { return chiSquareScores(ChiSquare(img)) }})
+	Register(detectorFunc{"rs", func(img image.Image) []ChannelScore { return rsScores(RSAnalysis(img)) }})
+	Register(detectorFunc{"spa", func(img image.Image) []ChannelScore { return spaScores(SPA(img)) }})
+	Register(detectorFunc{"ws", func(img image.Image) []ChannelScore { return wsScores(WS(img)) }})
+}
+
+func chiSquareScores(rs []ChiSquareResult) []ChannelScore {
+	out := make([]ChannelScore, len(rs))
+	for i, r := range rs {
+		out[i] = ChannelScore{Channel: r.Channel, Score: r.PValue, Confidence: 1, Suspicious: r.Suspicious}
+	}
+	return out
+}
+
+func rsScores(rs []RSResult) []ChannelScore {
+	out := make([]ChannelScore, len(rs))
+	for i, r := range rs {
+		out[i] = ChannelScore{Channel: r.Channel, Score: r.Rate, Confidence: r.Confidence, Suspicious: r.Suspicious}
+	}
+	return out
+}
+
+func spaScores(rs []SPAResult) []ChannelScore {
+	out := make([]ChannelScore, len(rs))
+	for i, r := range rs {
+		out[i] = ChannelScore{Channel: r.Channel, Score: r.Rate, Confidence: 1, Suspicious: r.Suspicious}
+	}
+	return out
+}
+
+func wsScores(rs []WSResult) []ChannelScore {
+	out := make([]ChannelScore, len(rs))
+	for i, r := range rs {
+		out[i] = ChannelScore{Channel: r.Channel, Score: r.Rate, Confidence: 1, Suspicious: r.Suspicious}
+	}
+	return out
+}
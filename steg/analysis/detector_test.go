@@ -0,0 +1,149 @@
+package analysis_test
+
+import (
+	"encoding/json"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/pableeee/steg/steg/analysis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// constDetector flags the channels listed in suspicious with confidence conf.
+type constDetector struct {
+	name       string
+	suspicious []bool
+	conf       float64
+}
+
+func (d constDetector) Name() string { return d.name }
+
+func (d constDetector) Detect(image.Image) []analysis.ChannelScore {
+	out := make([]analysis.ChannelScore, len(d.suspicious))
+	for i, s := range d.suspicious {
+		out[i] = analysis.ChannelScore{Channel: []string{"R", "G", "B"}[i], Confidence: d.conf, Suspicious: s}
+	}
+	return out
+}
+
+func TestRegistry(t *testing.T) {
+	names := analysis.RegisteredDetectors()
+	for _, builtin := range []string{"chi-square", "rs", "spa", "ws"} {
+		assert.Contains(t, names, builtin)
+	}
+
+	_, err := analysis.Lookup("no-such-detector")
+	assert.Error(t, err)
+
+	custom := constDetector{name: "test-registry", suspicious: []bool{true, false, false}, conf: 1}
+	analysis.Register(custom)
+	t.Cleanup(func() { analysis.Unregister("test-registry") })
+	d, err := analysis.Lookup("test-registry")
+	require.NoError(t, err)
+	assert.Equal(t, "test-registry", d.Name())
+	assert.Contains(t, analysis.RegisteredDetectors(), "test-registry")
+
+	assert.Panics(t, func() { analysis.Register(custom) }, "duplicate name")
+	assert.Panics(t, func() { analysis.Register(constDetector{}) }, "empty name")
+}
+
+// TestRunMatchesAnalyze checks that the built-in detectors combined with
+// CombineAll reproduce Analyze's verdict.
+func TestRunMatchesAnalyze(t *testing.T) {
+	var detectors []analysis.Detector
+	for _, name := range []string{"chi-square", "rs", "spa", "ws"} {
+		d, err := analysis.Lookup(name)
+		require.NoError(t, err)
+		detectors = append(detectors, d)
+	}
+	for _, img := range []*image.RGBA{naturalImage(200, 200), embedLSB(photoImage(200, 200), 1)} {
+		rep := analysis.Run(img, detectors, analysis.CombineAll)
+		require.Len(t, rep.Detectors, 4)
+		res := analysis.Analyze(img)
+		assert.Equal(t, res.Verdict, rep.Verdict)
+		for i, c := range rep.Detectors[2].Channels {
+			assert.Equal(t, res.SPA[i].Rate, c.Score, "SPA score is the estimated rate")
+		}
+	}
+}
+
+func TestCombiners(t *testing.T) {
+	none := constDetector{name: "none", suspicious: []bool{false, false, false}, conf: 1}
+	one := constDetector{name: "one", suspicious: []bool{true, false, false}, conf: 1}
+	all := constDetector{name: "all", suspicious: []bool{true, true, true}, conf: 1}
+	weak := constDetector{name: "weak", suspicious: []bool{true, true, true}, conf: 0.2}
+
+	tests := []struct {
+		name      string
+		combiner  analysis.Combiner
+		detectors []analysis.Detector
+		want      string
+	}{
+		{"all/clean", analysis.CombineAll, []analysis.Detector{none, none}, analysis.VerdictClean},
+		{"all/partial", analysis.CombineAll, []analysis.Detector{all, one}, analysis.VerdictSuspicious},
+		{"all/every channel", analysis.CombineAll, []analysis.Detector{all, all}, analysis.VerdictLikelyStego},
+		{"any/clean", analysis.CombineAny, []analysis.Detector{none, none}, analysis.VerdictClean},
+		{"any/one channel", analysis.CombineAny, []analysis.Detector{none, one}, analysis.VerdictLikelyStego},
+		{"majority/clean", analysis.CombineMajority, []analysis.Detector{none, none, none}, analysis.VerdictClean},
+		{"majority/minority", analysis.CombineMajority, []analysis.Detector{one, none, none}, analysis.VerdictSuspicious},
+		{"majority/half", analysis.CombineMajority, []analysis.Detector{one, none}, analysis.VerdictSuspicious},
+		{"majority/majority", analysis.CombineMajority, []analysis.Detector{one, all, none}, analysis.VerdictLikelyStego},
+		{"weighted/clean", analysis.CombineWeighted(nil), []analysis.Detector{none}, analysis.VerdictClean},
+		{"weighted/low confidence", analysis.CombineWeighted(nil), []analysis.Detector{weak, none}, analysis.VerdictSuspicious},
+		{"weighted/equal", analysis.CombineWeighted(nil), []analysis.Detector{one, none}, analysis.VerdictLikelyStego},
+		{"weighted/outvoted", analysis.CombineWeighted(map[string]float64{"none": 3}), []analysis.Detector{one, none}, analysis.VerdictSuspicious},
+		{"weighted/ignored", analysis.CombineWeighted(map[string]float64{"one": 0}), []analysis.Detector{one, none}, analysis.VerdictClean},
+	}
+	img := naturalImage(8, 8)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, analysis.Run(img, tt.detectors, tt.combiner).Verdict)
+		})
+	}
+}
+
+func TestROC(t *testing.T) {
+	t.Run("perfect separation", func(t *testing.T) {
+		points := analysis.ROC([]float64{0.1, 0.2, 0.3}, []float64{0.7, 0.8, 0.9})
+		assert.Equal(t, analysis.ROCPoint{Threshold: math.Inf(1)}, points[0])
+		assert.Equal(t, 1.0, points[len(points)-1].FPR)
+		assert.Equal(t, 1.0, points[len(points)-1].TPR)
+		assert.InDelta(t, 1.0, analysis.AUC(points), 1e-12)
+		assert.Equal(t, 1.0, analysis.TPRAtFPR(points, 0))
+	})
+
+	t.Run("inverted detector", func(t *testing.T) {
+		points := analysis.ROC([]float64{0.7, 0.8}, []float64{0.1, 0.2})
+		assert.InDelta(t, 0.0, analysis.AUC(points), 1e-12)
+		assert.Equal(t, 0.0, analysis.TPRAtFPR(points, 0.4))
+	})
+
+	t.Run("ties cross the threshold together", func(t *testing.T) {
+		points := analysis.ROC([]float64{0.5, 0.5}, []float64{0.5, 0.5})
+		require.Len(t, points, 2)
+		assert.Equal(t, analysis.ROCPoint{Threshold: 0.5, FPR: 1, TPR: 1}, points[1])
+		assert.InDelta(t, 0.5, analysis.AUC(points), 1e-12)
+	})
+
+	t.Run("partial overlap", func(t *testing.T) {
+		// Stego scores beat 3 of the 4 cover scores on average: AUC = 12/16.
+		cover := []float64{0.1, 0.2, 0.3, 0.6}
+		stego := []float64{0.25, 0.4, 0.5, 0.7}
+		points := analysis.ROC(cover, stego)
+		assert.InDelta(t, 0.75, analysis.AUC(points), 1e-12)
+		assert.Equal(t, 0.25, analysis.TPRAtFPR(points, 0))
+		assert.Equal(t, 0.75, analysis.TPRAtFPR(points, 0.25))
+	})
+}
+
+func TestROCPointJSON(t *testing.T) {
+	b, err := json.Marshal(analysis.ROC([]float64{0.1}, []float64{0.9}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"threshold": null, "fpr": 0, "tpr": 0},
+		{"threshold": 0.9, "fpr": 0, "tpr": 1},
+		{"threshold": 0.1, "fpr": 1, "tpr": 1}
+	]`, string(b))
+}
@@ -0,0 +1,7 @@
+package analysis
+
+// Unregister exposes unregister to the external tests.
+var Unregister = unregister
+
+// FlipNeg exposes flipNeg on 8-bit samples.
+func FlipNeg(x, top uint8) uint8 { return flipNeg(x, top) }
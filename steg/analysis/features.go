@@ -0,0 +1,101 @@
+package analysis
+
+import "image"
+
+// Feature extraction in the style of the spatial rich model (Fridrich &
+// Kodovský, 2012), reduced to a handful of submodels so it stays cheap:
+//
+//   - four residuals per channel: first- and second-order differences, each
+//     horizontally and vertically;
+//   - residuals quantised by q = 1 and truncated to [−T, T] with T = 2;
+//   - a co-occurrence histogram of three consecutive residuals taken along the
+//     residual's own direction, (2T+1)³ = 125 bins per residual.
+//
+// Histograms are summed over R, G and B and normalised to sum to 1, giving
+// FeatureDim features per image. LSB embedding adds ±1 noise that flattens
+// these histograms in a way that is measurable long before the single-statistic
+// tests react.
+
+const (
+	featureT    = 2
+	featureBins = (2*featureT + 1) * (2*featureT + 1) * (2*featureT + 1)
+	// FeatureSet names the feature layout; models record it so a model is
+	// never applied to features it was not trained on.
+	FeatureSet = "srm-lite-v1"
+	// FeatureDim is the length of the vector ExtractFeatures returns.
+	FeatureDim = 4 * featureBins
+)
+
+// residualKernel describes a residual: a linear prediction error along the
+// step (dx, dy), of first or second order.
+type residualKernel struct {
+	dx, dy int
+	order  int
+}
+
+var residualKernels = []residualKernel{
+	{1, 0, 1}, {0, 1, 1}, // first order: x[i+1] − x[i]
+	{1, 0, 2}, {0, 1, 2}, // second order: x[i−1] − 2x[i] + x[i+1]
+}
+
+// ExtractFeatures returns the rich-model feature vector of img, of length
+// FeatureDim.
+func ExtractFeatures(img image.Image) []float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	features := make([]float64, FeatureDim)
+	for ch := 0; ch < 3; ch++ {
+		vals := extractChannel(img, ch)
+		for k, kern := range residualKernels {
+			cooccurrence(features[k*featureBins:(k+1)*featureBins], vals, w, h, kern)
+		}
+	}
+	for k := range residualKernels {
+		normalize(features[k*featureBins : (k+1)*featureBins])
+	}
+	return features
+}
+
+// cooccurrence adds to hist the counts of every triple of consecutive
+// truncated residuals along the kernel's direction.
+func cooccurrence(hist []float64, vals []uint8, w, h int, kern residualKernel) {
+	residual := func(x, y int) int {
+		at := func(x, y int) int { return int(vals[y*w+x]) }
+		var r int
+		if kern.order == 1 {
+			r = at(x+kern.dx, y+kern.dy) - at(x, y)
+		} else {
+			r = at(x-kern.dx, y-kern.dy) - 2*at(x, y) + at(x+kern.dx, y+kern.dy)
+		}
+		return min(max(r, -featureT), featureT) + featureT
+	}
+
+	// The triple starting at (x, y) reads pixels up to three steps ahead and,
+	// for second-order residuals, one step behind.
+	lo := 0
+	if kern.order == 2 {
+		lo = 1
+	}
+	const span = 2*featureT + 1
+	for y := lo * kern.dy; y+3*kern.dy < h; y++ {
+		for x := lo * kern.dx; x+3*kern.dx < w; x++ {
+			a := residual(x, y)
+			b := residual(x+kern.dx, y+kern.dy)
+			c := residual(x+2*kern.dx, y+2*kern.dy)
+			hist[(a*span+b)*span+c]++
+		}
+	}
+}
+
+func normalize(v []float64) {
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	if sum == 0 {
+		return
+	}
+	for i := range v {
+		v[i] /= sum
+	}
+}
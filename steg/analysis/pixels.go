@@ -1,9 +1,15 @@
 package analysis
 
-import "image"
+import (
+	"image"
+	"image/color"
+)
 
 // extractChannel returns the 8-bit channel values for all pixels in img.
 // ch: 0=R, 1=G, 2=B. Pixels are returned in row-major order.
+//
+// The detectors read channels with imageChannels instead; extractChannel is
+// the fixed 8-bit RGB view used by the feature extractor and by Compare.
 func extractChannel(img image.Image, ch int) []uint8 {
 	b := img.Bounds()
 	w, h := b.Dx(), b.Dy()
@@ -25,3 +31,126 @@ func extractChannel(img image.Image, ch int) []uint8 {
 	}
 	return vals
 }
+
+// sample is the type of a channel sample at its native depth.
+type sample interface {
+	~uint8 | ~uint16
+}
+
+// channel holds one channel of an image at its native depth, in row-major
+// order. Exactly one of u8 and u16 is set.
+type channel struct {
+	name string
+	u8   []uint8
+	u16  []uint16
+}
+
+// depth returns the number of bits per sample.
+func (c channel) depth() int {
+	if c.u16 != nil {
+		return 16
+	}
+	return 8
+}
+
+// imageChannels returns the channels of img that the detectors analyse,
+// chosen from its colour model:
+//
+//   - grayscale models have a single channel, Y, and so does a colour image
+//     whose R, G and B samples are equal in every pixel;
+//   - 16-bit models (Gray16, RGBA64, NRGBA64) are read at 16 bits per sample,
+//     everything else at 8;
+//   - non-premultiplied models (NRGBA, NRGBA64) are read as stored, since
+//     premultiplying would destroy the low bits of translucent pixels;
+//   - an alpha channel, A, follows the colour channels when some pixel is not
+//     fully opaque. A fully opaque alpha channel carries nothing to analyse.
+func imageChannels(img image.Image) []channel {
+	b := img.Bounds()
+	n := b.Dx() * b.Dy()
+	model := img.ColorModel()
+
+	depth := 8
+	switch model {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model:
+		depth = 16
+	}
+	opaque := uint16(1<<depth - 1)
+
+	r, g, bl, a := make([]uint16, n), make([]uint16, n), make([]uint16, n), make([]uint16, n)
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.At(x, y)
+			switch model {
+			case color.GrayModel:
+				v := uint16(color.GrayModel.Convert(c).(color.Gray).Y)
+				r[i], g[i], bl[i], a[i] = v, v, v, opaque
+			case color.Gray16Model:
+				v := color.Gray16Model.Convert(c).(color.Gray16).Y
+				r[i], g[i], bl[i], a[i] = v, v, v, opaque
+			case color.NRGBAModel:
+				p := color.NRGBAModel.Convert(c).(color.NRGBA)
+				r[i], g[i], bl[i], a[i] = uint16(p.R), uint16(p.G), uint16(p.B), uint16(p.A)
+			case color.NRGBA64Model:
+				p := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+				r[i], g[i], bl[i], a[i] = p.R, p.G, p.B, p.A
+			case color.RGBA64Model:
+				cr, cg, cb, ca := c.RGBA()
+				r[i], g[i], bl[i], a[i] = uint16(cr), uint16(cg), uint16(cb), uint16(ca)
+			default:
+				cr, cg, cb, ca := c.RGBA()
+				r[i], g[i], bl[i], a[i] = uint16(cr>>8), uint16(cg>>8), uint16(cb>>8), uint16(ca>>8)
+			}
+			i++
+		}
+	}
+
+	gray, hasAlpha := true, false
+	for i := range r {
+		if r[i] != g[i] || r[i] != bl[i] {
+			gray = false
+		}
+		if a[i] != opaque {
+			hasAlpha = true
+		}
+	}
+
+	var names []string
+	var planes [][]uint16
+	if gray {
+		names, planes = []string{"Y"}, [][]uint16{r}
+	} else {
+		names, planes = []string{"R", "G", "B"}, [][]uint16{r, g, bl}
+	}
+	if hasAlpha {
+		names, planes = append(names, "A"), append(planes, a)
+	}
+
+	channels := make([]channel, len(planes))
+	for k, p := range planes {
+		channels[k].name = names[k]
+		if depth == 16 {
+			channels[k].u16 = p
+			continue
+		}
+		channels[k].u8 = make([]uint8, len(p))
+		for i, v := range p {
+			channels[k].u8[i] = uint8(v)
+		}
+	}
+	return channels
+}
+
+// mapChannels calls f8 or f16 on each channel, according to its depth, and
+// returns the results in channel order.
+func mapChannels[R any](channels []channel, f8 func(name string, vals []uint8) R, f16 func(name string, vals []uint16) R) []R {
+	out := make([]R, len(channels))
+	for i, c := range channels {
+		if c.u16 != nil {
+			out[i] = f16(c.name, c.u16)
+		} else {
+			out[i] = f8(c.name, c.u8)
+		}
+	}
+	return out
+}
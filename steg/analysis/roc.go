@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// ROCPoint is one operating point of a detector: flagging every image whose
+// score is at least Threshold gives the false- and true-positive rates FPR and
+// TPR.
+type ROCPoint struct {
+	Threshold float64 `json:"threshold"`
+	FPR       float64 `json:"fpr"`
+	TPR       float64 `json:"tpr"`
+}
+
+// ROC returns the receiver operating characteristic of a detector from its
+// scores on clean covers and on stego images, where a higher score means more
+// suspicious. Points run from (0, 0) at an infinite threshold to (1, 1), with
+// one point per distinct score.
+func ROC(cover, stego []float64) []ROCPoint {
+	type sample struct {
+		score float64
+		stego bool
+	}
+	samples := make([]sample, 0, len(cover)+len(stego))
+	for _, s := range cover {
+		samples = append(samples, sample{s, false})
+	}
+	for _, s := range stego {
+		samples = append(samples, sample{s, true})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].score > samples[j].score })
+
+	points := []ROCPoint{{Threshold: math.Inf(1)}}
+	var fp, tp int
+	for i := 0; i < len(samples); {
+		// Samples with equal scores cross the threshold together.
+		score := samples[i].score
+		for ; i < len(samples) && samples[i].score == score; i++ {
+			if samples[i].stego {
+				tp++
+			} else {
+				fp++
+			}
+		}
+		points = append(points, ROCPoint{
+			Threshold: score,
+			FPR:       rate(fp, len(cover)),
+			TPR:       rate(tp, len(stego)),
+		})
+	}
+	return points
+}
+
+// MarshalJSON encodes the infinite threshold of the first point as null,
+// since JSON has no infinity.
+func (p ROCPoint) MarshalJSON() ([]byte, error) {
+	type plain ROCPoint
+	if !math.IsInf(p.Threshold, 0) {
+		return json.Marshal(plain(p))
+	}
+	return json.Marshal(struct {
+		Threshold *float64 `json:"threshold"`
+		FPR       float64  `json:"fpr"`
+		TPR       float64  `json:"tpr"`
+	}{nil, p.FPR, p.TPR})
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// AUC returns the area under an ROC curve computed by the trapezoidal rule:
+// 1 for a perfect detector, 0.5 for one no better than chance.
+func AUC(points []ROCPoint) float64 {
+	var area float64
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		area += (b.FPR - a.FPR) * (a.TPR + b.TPR) / 2
+	}
+	return area
+}
+
+// TPRAtFPR returns the highest true-positive rate reachable without exceeding
+// the false-positive rate fpr.
+func TPRAtFPR(points []ROCPoint, fpr float64) float64 {
+	var best float64
+	for _, p := range points {
+		if p.FPR <= fpr && p.TPR > best {
+			best = p.TPR
+		}
+	}
+	return best
+}
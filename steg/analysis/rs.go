@@ -1,95 +1,303 @@
 package analysis
 
 import (
+	"fmt"
 	"image"
 	"math"
 )
 
-// RSAnalysis runs the Regular-Singular (RS) steganalysis on all three channels
-// of img. It applies a flipping mask to groups of 4 adjacent horizontal pixels
-// and measures the asymmetry between the positive and negative mask responses.
+// Mask is an RS flipping mask over a rectangular group of pixels. Each entry
+// is 1 (apply the positive flip F1), -1 (apply the negative flip F−1) or 0
+// (leave the pixel alone). Groups tile the channel without overlap, and the
+// pixels of a group are read in snake order — left to right on even rows,
+// right to left on odd rows — so that consecutive pixels are always adjacent.
+type Mask struct {
+	Name string
+	Grid [][]int
+}
+
+var (
+	// MaskHorizontal is the classic [1,0,1,0] mask on four horizontal pixels.
+	MaskHorizontal = Mask{Name: "horizontal", Grid: [][]int{{1, 0, 1, 0}}}
+	// MaskHorizontalInner flips the two middle pixels of a horizontal group.
+	MaskHorizontalInner = Mask{Name: "horizontal-inner", Grid: [][]int{{0, 1, 1, 0}}}
+	// MaskVertical is [1,0,1,0] on four vertically adjacent pixels.
+	MaskVertical = Mask{Name: "vertical", Grid: [][]int{{1}, {0}, {1}, {0}}}
+	// MaskSquare is a 2×2 checkerboard.
+	MaskSquare = Mask{Name: "square", Grid: [][]int{{1, 0}, {0, 1}}}
+)
+
+// DefaultMasks are the masks RSAnalysis uses. The first one determines the
+// reported Rm/Sm/Rnm/Snm and Asymmetry; all of them contribute to Rate.
+var DefaultMasks = []Mask{MaskHorizontal, MaskVertical, MaskSquare}
+
+func (m Mask) validate() error {
+	if len(m.Grid) == 0 || len(m.Grid[0]) == 0 {
+		return fmt.Errorf("mask %q is empty", m.Name)
+	}
+	active := 0
+	for _, row := range m.Grid {
+		if len(row) != len(m.Grid[0]) {
+			return fmt.Errorf("mask %q is not rectangular", m.Name)
+		}
+		for _, v := range row {
+			if v < -1 || v > 1 {
+				return fmt.Errorf("mask %q has entry %d; entries must be -1, 0 or 1", m.Name, v)
+			}
+			if v != 0 {
+				active++
+			}
+		}
+	}
+	if active == 0 {
+		return fmt.Errorf("mask %q flips no pixels", m.Name)
+	}
+	if len(m.Grid)*len(m.Grid[0]) < 2 {
+		return fmt.Errorf("mask %q must cover at least two pixels", m.Name)
+	}
+	return nil
+}
+
+// RSAnalysis runs the Regular-Singular (RS) steganalysis on every channel of
+// img (see imageChannels) using DefaultMasks. It measures the asymmetry between the positive
+// and negative mask responses and, following Fridrich, Goljan & Du (2001),
+// solves for the embedded message length.
 //
 // A positive Asymmetry (Rm > Rnm) is the signature of LSB embedding.
 // Values > 0.01 are considered suspicious.
 func RSAnalysis(img image.Image) []RSResult {
-	b := img.Bounds()
-	w := b.Dx()
-	names := []string{"R", "G", "B"}
-	results := make([]RSResult, 3)
-	for ch := 0; ch < 3; ch++ {
-		results[ch] = channelRS(names[ch], extractChannel(img, ch), w)
-	}
+	results, _ := RSAnalysisWithMasks(img, DefaultMasks...)
 	return results
 }
 
+// RSAnalysisWithMasks runs RS analysis with the given masks instead of
+// DefaultMasks. It returns an error if no mask is given or a mask is invalid.
+func RSAnalysisWithMasks(img image.Image, masks ...Mask) ([]RSResult, error) {
+	if len(masks) == 0 {
+		return nil, fmt.Errorf("at least one mask is required")
+	}
+	for _, m := range masks {
+		if err := m.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return rsChannels(imageChannels(img), img.Bounds().Dx(), masks), nil
+}
+
+func rsChannels(channels []channel, width int, masks []Mask) []RSResult {
+	return mapChannels(channels,
+		func(name string, vals []uint8) RSResult { return channelRS(name, vals, width, masks) },
+		func(name string, vals []uint16) RSResult { return channelRS(name, vals, width, masks) },
+	)
+}
+
 // flipPos applies the positive flipping function: toggles the LSB (XOR 1).
 // Swaps pairs: 0↔1, 2↔3, 4↔5, ...
-func flipPos(x uint8) uint8 { return x ^ 1 }
+func flipPos[S sample](x S) S { return x ^ 1 }
 
 // flipNeg applies the negative flipping function: shifts pairs left by one.
-// Swaps: 1↔2, 3↔4, 5↔6, ...; 0 wraps to 255.
-func flipNeg(x uint8) uint8 {
-	if x%2 == 0 {
-		return x - 1 // even → odd (0 wraps to 255 in uint8 arithmetic)
+// Swaps: 1↔2, 3↔4, 5↔6, ...; 0 and top, the largest value the samples can
+// take, swap with each other. top is odd.
+func flipNeg[S sample](x, top S) S {
+	switch {
+	case x == 0:
+		return top
+	case x == top:
+		return 0
+	case x%2 == 0:
+		return x - 1
 	}
-	return x + 1 // odd → even (255 wraps to 0 in uint8 arithmetic)
+	return x + 1
 }
 
-// roughness returns the sum of absolute differences between adjacent pixels.
-func roughness(a, b, c, d uint8) float64 {
-	return math.Abs(float64(a)-float64(b)) +
-		math.Abs(float64(b)-float64(c)) +
-		math.Abs(float64(c)-float64(d))
+// applyFlip applies the flipping function selected by a mask entry, negated
+// when sign is -1. top is the largest sample value, as for flipNeg.
+func applyFlip[S sample](x, top S, entry, sign int) S {
+	switch entry * sign {
+	case 1:
+		return flipPos(x)
+	case -1:
+		return flipNeg(x, top)
+	}
+	return x
 }
 
-// channelRS computes RS statistics for one channel. vals is a row-major slice
-// of pixel values; width is the image width in pixels.
-//
-// Mask M = [1,0,1,0]: the flipping function is applied to positions 0 and 2
-// in each group of 4 adjacent horizontal pixels.
-func channelRS(name string, vals []uint8, width int) RSResult {
-	height := len(vals) / width
-	var rm, sm, rnm, snm, total float64
+// roughness returns the sum of absolute differences between consecutive
+// pixels of a group.
+func roughness[S sample](g []S) float64 {
+	var sum float64
+	for i := 1; i < len(g); i++ {
+		sum += math.Abs(float64(g[i-1]) - float64(g[i]))
+	}
+	return sum
+}
 
-	for y := 0; y < height; y++ {
-		for x := 0; x+3 < width; x += 4 {
-			i := y*width + x
-			p0, p1, p2, p3 := vals[i], vals[i+1], vals[i+2], vals[i+3]
+// rsCounts holds the regular/singular fractions under a mask and its negation.
+type rsCounts struct {
+	rm, sm, rnm, snm float64
+}
 
-			orig := roughness(p0, p1, p2, p3)
+// maskCounts classifies every group of the channel under m and −m. When
+// invert is set all LSBs are flipped first, which gives the statistics of the
+// image as if it had been embedded at rate 1 − p/2 instead of p/2. top is the
+// largest value the samples can take.
+func maskCounts[S sample](vals []S, top S, width int, m Mask, invert bool) rsCounts {
+	height := len(vals) / width
+	rows, cols := len(m.Grid), len(m.Grid[0])
+	group := make([]S, rows*cols)
+	entries := make([]int, rows*cols)
+	flipped := make([]S, rows*cols)
 
-			// Positive mask M=[1,0,1,0]: flipPos on positions 0 and 2.
-			mp := roughness(flipPos(p0), p1, flipPos(p2), p3)
+	// Snake order of the mask entries is fixed; compute it once.
+	k := 0
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			cc := c
+			if r%2 == 1 {
+				cc = cols - 1 - c
+			}
+			entries[k] = m.Grid[r][cc]
+			k++
+		}
+	}
 
-			// Negative mask -M=[−1,0,−1,0]: flipNeg on positions 0 and 2.
-			mn := roughness(flipNeg(p0), p1, flipNeg(p2), p3)
+	var res rsCounts
+	var total float64
+	for gy := 0; gy+rows <= height; gy += rows {
+		for gx := 0; gx+cols <= width; gx += cols {
+			k := 0
+			for r := 0; r < rows; r++ {
+				for c := 0; c < cols; c++ {
+					cc := c
+					if r%2 == 1 {
+						cc = cols - 1 - c
+					}
+					v := vals[(gy+r)*width+gx+cc]
+					if invert {
+						v ^= 1
+					}
+					group[k] = v
+					k++
+				}
+			}
+
+			orig := roughness(group)
+			for i, v := range group {
+				flipped[i] = applyFlip(v, top, entries[i], 1)
+			}
+			mp := roughness(flipped)
+			for i, v := range group {
+				flipped[i] = applyFlip(v, top, entries[i], -1)
+			}
+			mn := roughness(flipped)
 
 			total++
 			if mp > orig {
-				rm++
+				res.rm++
 			} else if mp < orig {
-				sm++
+				res.sm++
 			}
 			if mn > orig {
-				rnm++
+				res.rnm++
 			} else if mn < orig {
-				snm++
+				res.snm++
 			}
 		}
 	}
 
-	if total == 0 {
-		return RSResult{Channel: name}
+	if total > 0 {
+		res.rm /= total
+		res.sm /= total
+		res.rnm /= total
+		res.snm /= total
 	}
+	return res
+}
 
-	res := RSResult{
-		Channel: name,
-		Rm:      rm / total,
-		Sm:      sm / total,
-		Rnm:     rnm / total,
-		Snm:     snm / total,
+// rsEstimate solves Fridrich's quadratic for the embedding rate from the
+// statistics of the image (c0) and of its LSB-inverted copy (c1):
+//
+//	2(d1 + d0)·z² + (d−0 − d−1 − d1 − 3d0)·z + d0 − d−0 = 0,  p = z / (z − ½)
+//
+// where dX = R − S under the positive mask and d−X under the negative mask.
+// The root of smaller magnitude is used. ok is false when the equation is
+// degenerate (all coefficients vanish), as on images whose groups never change
+// class under flipping.
+func rsEstimate(c0, c1 rsCounts) (rate float64, ok bool) {
+	d0, d1 := c0.rm-c0.sm, c1.rm-c1.sm
+	dn0, dn1 := c0.rnm-c0.snm, c1.rnm-c1.snm
+	a := 2 * (d1 + d0)
+	b := dn0 - dn1 - d1 - 3*d0
+	c := d0 - dn0
+
+	var z float64
+	if math.Abs(a) < 1e-12 {
+		if math.Abs(b) < 1e-12 {
+			return 0, false
+		}
+		z = -c / b
+	} else {
+		// Near p = 1 sampling noise can push the discriminant slightly below
+		// zero; as in SPA, fall back to the vertex of the parabola.
+		disc := math.Max(0, b*b-4*a*c)
+		sq := math.Sqrt(disc)
+		z1, z2 := (-b+sq)/(2*a), (-b-sq)/(2*a)
+		z = z1
+		if math.Abs(z2) < math.Abs(z1) {
+			z = z2
+		}
+	}
+	if z == 0.5 {
+		return 0, false
+	}
+	p := z / (z - 0.5)
+	return math.Max(0, math.Min(1, p)), true
+}
+
+// channelRS computes RS statistics for one channel. vals is a row-major slice
+// of pixel values; width is the image width in pixels. The first mask supplies
+// the reported fractions and Asymmetry. Rate averages the length estimates of
+// every mask that produced an estimate; Confidence is the share of
+// masks that produced an estimate, reduced by how far those estimates spread.
+func channelRS[S sample](name string, vals []S, width int, masks []Mask) RSResult {
+	return rangeRS(name, vals, ^S(0), width, masks)
+}
+
+// rangeRS is channelRS for samples in [0, top], such as the bit plane values
+// of planeValues. The negative flipping function wraps at top, not at the
+// maximum of S.
+func rangeRS[S sample](name string, vals []S, top S, width int, masks []Mask) RSResult {
+	res := RSResult{Channel: name}
+	var estimates []float64
+	for i, m := range masks {
+		c0 := maskCounts(vals, top, width, m, false)
+		c1 := maskCounts(vals, top, width, m, true)
+		rate, ok := rsEstimate(c0, c1)
+		res.Masks = append(res.Masks, RSMaskResult{
+			Mask: m.Name, Rm: c0.rm, Sm: c0.sm, Rnm: c0.rnm, Snm: c0.snm, Rate: rate, Valid: ok,
+		})
+		if i == 0 {
+			res.Rm, res.Sm, res.Rnm, res.Snm = c0.rm, c0.sm, c0.rnm, c0.snm
+		}
+		if ok {
+			estimates = append(estimates, rate)
+		}
 	}
+
 	res.Asymmetry = res.Rm - res.Rnm
 	res.Suspicious = res.Asymmetry > 0.01
+	if len(estimates) == 0 {
+		return res
+	}
+
+	lo, hi, sum := estimates[0], estimates[0], 0.0
+	for _, e := range estimates {
+		sum += e
+		lo = math.Min(lo, e)
+		hi = math.Max(hi, e)
+	}
+	res.Rate = sum / float64(len(estimates))
+	res.Confidence = float64(len(estimates)) / float64(len(masks)) * math.Max(0, 1-2*(hi-lo))
 	return res
 }
@@ -0,0 +1,190 @@
+package analysis
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// rsTileThreshold is the RS rate above which a tile is flagged. It is much
+// higher than the whole-image thresholds because estimates from a few thousand
+// samples are noisy: clean 64×64 tiles of a photograph routinely read 0.2.
+const rsTileThreshold = 0.4
+
+// TileOptions selects the tiles for block-wise analysis. Size is the side of
+// each square tile in pixels and Stride the distance between neighbouring tile
+// origins: Stride == Size gives disjoint blocks, a smaller Stride a sliding
+// window. A zero Stride means Size.
+type TileOptions struct {
+	Size   int
+	Stride int
+}
+
+// TileGrid holds one score per tile in row-major order. Tile (col, row) covers
+// the Size×Size square whose top-left corner is (Xs[col], Ys[row]), relative to
+// the image bounds. When the image size is not a whole number of strides, the
+// last column and row are placed flush with the right and bottom edges so
+// every pixel is covered.
+type TileGrid struct {
+	Test       string // "chi-square" or "rs"
+	Size       int
+	Cols, Rows int
+	Xs, Ys     []int
+	Scores     []float64 // in [0,1], maximum over the channels of the image
+	Threshold  float64   // scores above this are suspicious
+}
+
+// At returns the score of tile (col, row).
+func (g TileGrid) At(col, row int) float64 { return g.Scores[row*g.Cols+col] }
+
+// Suspicious returns the number of tiles scoring above Threshold.
+func (g TileGrid) Suspicious() int {
+	n := 0
+	for _, s := range g.Scores {
+		if s > g.Threshold {
+			n++
+		}
+	}
+	return n
+}
+
+// ChiSquareTiles runs the chi-square test on every tile of img. A tile's score
+// is its highest per-channel p-value. Small tiles rarely contain all 128 value
+// pairs, so the degrees of freedom are the number of pairs present minus one
+// rather than the fixed 127 ChiSquare uses for 8-bit samples.
+func ChiSquareTiles(img image.Image, opts TileOptions) (TileGrid, error) {
+	g, err := newTileGrid("chi-square", img, opts, 0.05)
+	if err != nil {
+		return g, err
+	}
+	g.scoreTiles(img, chiSquareTileScore[uint8], chiSquareTileScore[uint16])
+	return g, nil
+}
+
+// RSTiles runs RS analysis with DefaultMasks on every tile of img. A tile's
+// score is its highest per-channel estimated embedding rate.
+func RSTiles(img image.Image, opts TileOptions) (TileGrid, error) {
+	g, err := newTileGrid("rs", img, opts, rsTileThreshold)
+	if err != nil {
+		return g, err
+	}
+	g.scoreTiles(img,
+		func(vals []uint8) float64 { return channelRS("", vals, g.Size, DefaultMasks).Rate },
+		func(vals []uint16) float64 { return channelRS("", vals, g.Size, DefaultMasks).Rate },
+	)
+	return g, nil
+}
+
+func chiSquareTileScore[S sample](vals []S) float64 {
+	chiSq, pairs := chiSquareStat(vals)
+	return chi2PValue(chiSq, max(pairs-1, 1))
+}
+
+func newTileGrid(test string, img image.Image, opts TileOptions, threshold float64) (TileGrid, error) {
+	stride := opts.Stride
+	if stride == 0 {
+		stride = opts.Size
+	}
+	b := img.Bounds()
+	switch {
+	case opts.Size < 8:
+		return TileGrid{}, fmt.Errorf("tile size must be at least 8, got %d", opts.Size)
+	case stride < 1 || stride > opts.Size:
+		return TileGrid{}, fmt.Errorf("tile stride must be between 1 and the tile size, got %d", stride)
+	case opts.Size > b.Dx() || opts.Size > b.Dy():
+		return TileGrid{}, fmt.Errorf("tile size %d exceeds image size %dx%d", opts.Size, b.Dx(), b.Dy())
+	}
+	xs := tileOrigins(b.Dx(), opts.Size, stride)
+	ys := tileOrigins(b.Dy(), opts.Size, stride)
+	return TileGrid{
+		Test:      test,
+		Size:      opts.Size,
+		Cols:      len(xs),
+		Rows:      len(ys),
+		Xs:        xs,
+		Ys:        ys,
+		Scores:    make([]float64, len(xs)*len(ys)),
+		Threshold: threshold,
+	}, nil
+}
+
+// tileOrigins returns the tile start offsets along an axis of length n.
+func tileOrigins(n, size, stride int) []int {
+	var out []int
+	for o := 0; o+size <= n; o += stride {
+		out = append(out, o)
+	}
+	if last := out[len(out)-1]; last+size < n {
+		out = append(out, n-size)
+	}
+	return out
+}
+
+// scoreTiles sets each tile's score to the maximum of the score function over
+// the channels of img, as chosen by imageChannels. The samples of a tile are
+// passed in row-major order with width g.Size; score8 and score16 handle 8-
+// and 16-bit channels.
+func (g TileGrid) scoreTiles(img image.Image, score8 func(vals []uint8) float64, score16 func(vals []uint16) float64) {
+	w := img.Bounds().Dx()
+	for _, c := range imageChannels(img) {
+		if c.u16 != nil {
+			scoreChannelTiles(g, c.u16, w, score16)
+		} else {
+			scoreChannelTiles(g, c.u8, w, score8)
+		}
+	}
+}
+
+func scoreChannelTiles[S sample](g TileGrid, vals []S, width int, score func(vals []S) float64) {
+	buf := make([]S, g.Size*g.Size)
+	for row, y0 := range g.Ys {
+		for col, x0 := range g.Xs {
+			for y := 0; y < g.Size; y++ {
+				copy(buf[y*g.Size:(y+1)*g.Size], vals[(y0+y)*width+x0:])
+			}
+			i := row*g.Cols + col
+			g.Scores[i] = math.Max(g.Scores[i], score(buf))
+		}
+	}
+}
+
+// Heatmap renders g over a grayscale copy of img. Each pixel takes the highest
+// score of the tiles covering it, mapped from green (0) through yellow to red
+// (1), and blended half-and-half with the image so regions stay recognisable.
+func Heatmap(img image.Image, g TileGrid) (*image.RGBA, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if len(g.Xs) == 0 || g.Xs[len(g.Xs)-1]+g.Size > w || g.Ys[len(g.Ys)-1]+g.Size > h {
+		return nil, fmt.Errorf("tile grid does not fit a %dx%d image", w, h)
+	}
+
+	heat := make([]float64, w*h)
+	for row, y0 := range g.Ys {
+		for col, x0 := range g.Xs {
+			s := g.At(col, row)
+			for y := y0; y < y0+g.Size; y++ {
+				for x := x0; x < x0+g.Size; x++ {
+					heat[y*w+x] = math.Max(heat[y*w+x], s)
+				}
+			}
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gray := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			s := math.Max(0, math.Min(1, heat[y*w+x]))
+			r := 255 * math.Min(1, 2*s)
+			gr := 255 * math.Min(1, 2*(1-s))
+			out.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + float64(gray)) / 2),
+				G: uint8((gr + float64(gray)) / 2),
+				B: gray / 2,
+				A: 255,
+			})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// DiffMap renders the per-channel absolute difference between cover and stego
+// as an opaque RGBA image: each output sample is |stego − cover| × amplify,
+// clamped to 255. With amplify = 255 every changed sample is fully lit.
+func DiffMap(cover, stego image.Image, amplify int) (*image.RGBA, error) {
+	cb, sb := cover.Bounds(), stego.Bounds()
+	if cb.Dx() != sb.Dx() || cb.Dy() != sb.Dy() {
+		return nil, fmt.Errorf("image sizes differ: %dx%d vs %dx%d", cb.Dx(), cb.Dy(), sb.Dx(), sb.Dy())
+	}
+	if amplify < 1 {
+		return nil, fmt.Errorf("amplify must be at least 1, got %d", amplify)
+	}
+	w, h := cb.Dx(), cb.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	var diffs [3][]uint8
+	for ch := 0; ch < 3; ch++ {
+		c := extractChannel(cover, ch)
+		s := extractChannel(stego, ch)
+		d := make([]uint8, len(c))
+		for i := range c {
+			delta := int(s[i]) - int(c[i])
+			if delta < 0 {
+				delta = -delta
+			}
+			d[i] = uint8(min(delta*amplify, 255))
+		}
+		diffs[ch] = d
+	}
+	for i := 0; i < w*h; i++ {
+		out.SetRGBA(i%w, i/w, color.RGBA{diffs[0][i], diffs[1][i], diffs[2][i], 255})
+	}
+	return out, nil
+}
+
+// BitPlane renders bit plane bit (0 = LSB) of channel ch (0=R, 1=G, 2=B) as a
+// black-and-white image: white where the bit is set. On the LSB plane of a
+// natural image this shows structure from the picture; embedded data shows up
+// as uniform noise — the classic visual attack.
+func BitPlane(img image.Image, ch, bit int) (*image.Gray, error) {
+	if ch < 0 || ch > 2 {
+		return nil, fmt.Errorf("channel must be 0 (R), 1 (G) or 2 (B), got %d", ch)
+	}
+	if bit < 0 || bit > 7 {
+		return nil, fmt.Errorf("bit must be between 0 and 7, got %d", bit)
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for i, v := range extractChannel(img, ch) {
+		if v>>bit&1 == 1 {
+			out.Pix[(i/w)*out.Stride+i%w] = 255
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package steg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"image/draw"
+	"io"
+
+	"github.com/pableeee/steg/steg/container"
+)
+
+// chunkDataBytes is the length of padded payload covered by one tag in the
+// random-access layout. The last chunk also takes the remainder, so it holds
+// up to chunkDataBytes+32 bytes.
+const chunkDataBytes = 4096
+
+// randomAccessFlag is set in the container length of the random-access
+// layout. Where the payload fits in one chunk both layouts have the same
+// padded length, and the flag still tells them apart.
+const randomAccessFlag = 1 << 31
+
+// chunkLayout describes the random-access layout (WithRandomAccess) of an
+// image. The salt and the container length come first, as in the single-tag
+// layout; the padded payload follows in chunks, each followed by a 32-byte
+// HMAC-SHA256 tag over its index, the padded length and its data. The
+// container length is the padded length with randomAccessFlag set. The tags
+// bind every chunk to its place, so chunks cannot be reordered, dropped or
+// moved between images of different capacity.
+type chunkLayout struct {
+	paddedLen int64 // bytes of padded payload: real-length prefix, payload and padding
+	chunks    int64
+}
+
+// newChunkLayout returns the random-access layout of m. It has no chunks when
+// m is too small to hold any payload.
+func newChunkLayout(m draw.Image, bitsPerChannel, channels int) chunkLayout {
+	b := m.Bounds()
+	region := int64(b.Dx()*b.Dy()*channels*bitsPerChannel/8) - dataStart
+	if region <= 32+4 {
+		return chunkLayout{}
+	}
+	// The fewest chunks that leave the last one at least one byte of data.
+	n := (region - 32 + chunkDataBytes + 31) / (chunkDataBytes + 32)
+	return chunkLayout{paddedLen: region - 32*n, chunks: n}
+}
+
+// streamLen returns the stream length of the chunks and their tags.
+func (l chunkLayout) streamLen() int64 {
+	return l.paddedLen + 32*l.chunks
+}
+
+// index returns the chunk holding byte pos of the padded payload.
+func (l chunkLayout) index(pos int64) int64 {
+	return min(pos/chunkDataBytes, l.chunks-1)
+}
+
+// bounds returns the range of the padded payload held by chunk i.
+func (l chunkLayout) bounds(i int64) (from, to int64) {
+	from = i * chunkDataBytes
+	if i == l.chunks-1 {
+		return from, l.paddedLen
+	}
+	return from, from + chunkDataBytes
+}
+
+// offset returns the stream offset of chunk i.
+func (l chunkLayout) offset(i int64) int64 {
+	return dataStart + i*(chunkDataBytes+32)
+}
+
+// tag returns the tag of chunk i holding data.
+func (l chunkLayout) tag(macKey []byte, i int64, data []byte) []byte {
+	var hdr [16]byte
+	binary.LittleEndian.PutUint64(hdr[:8], uint64(i))
+	binary.LittleEndian.PutUint64(hdr[8:], uint64(l.paddedLen))
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(hdr[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// frame returns padded with the tag of each chunk after it, as embedded from
+// dataStart.
+func (l chunkLayout) frame(padded, macKey []byte) []byte {
+	out := make([]byte, 0, l.streamLen())
+	for i := range l.chunks {
+		from, to := l.bounds(i)
+		out = append(out, padded[from:to]...)
+		out = append(out, l.tag(macKey, i, padded[from:to])...)
+	}
+	return out
+}
+
+// unframe checks the tag of every chunk in framed and returns the padded
+// payload, or container.ErrChecksumMismatch.
+func (l chunkLayout) unframe(framed, macKey []byte) ([]byte, error) {
+	padded := make([]byte, 0, l.paddedLen)
+	for i := range l.chunks {
+		from, to := l.bounds(i)
+		chunk := framed[l.offset(i)-dataStart:][:to-from+32]
+		if !hmac.Equal(l.tag(macKey, i, chunk[:to-from]), chunk[to-from:]) {
+			return nil, container.ErrChecksumMismatch
+		}
+		padded = append(padded, chunk[:to-from]...)
+	}
+	return padded, nil
+}
+
+// readChunk reads chunk i from r, a payload stack, and checks its tag. It
+// returns the chunk's data, or container.ErrChecksumMismatch.
+func (l chunkLayout) readChunk(r io.ReadSeeker, macKey []byte, i int64) ([]byte, error) {
+	from, to := l.bounds(i)
+	if _, err := r.Seek(l.offset(i), io.SeekStart); err != nil {
+		return nil, err
+	}
+	chunk := make([]byte, to-from+32)
+	if _, err := io.ReadFull(r, chunk); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(l.tag(macKey, i, chunk[:to-from]), chunk[to-from:]) {
+		return nil, container.ErrChecksumMismatch
+	}
+	return chunk[:to-from], nil
+}
+
+// writeChunk embeds data as chunk i into w, a payload stack, followed by its
+// tag.
+func (l chunkLayout) writeChunk(w io.WriteSeeker, macKey []byte, i int64, data []byte) error {
+	if _, err := w.Seek(l.offset(i), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.Write(l.tag(macKey, i, data))
+	return err
+}
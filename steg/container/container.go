@@ -3,11 +3,16 @@ package container
 import (
 	"crypto/hmac"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
 )
 
+// ErrChecksumMismatch is returned when the stored tag does not match the
+// payload read back from the stream.
+var ErrChecksumMismatch = errors.New("checksum validation failed")
+
 func WritePayload(w io.WriteSeeker, payload io.Reader, hashFn hash.Hash) error {
 	// Capture current position. When called from encode, basePos=4 (after nonce).
 	// When called directly (container tests), basePos=0. Behavior identical in both cases.
@@ -77,8 +82,49 @@ func ReadPayload(r io.ReadWriteSeeker, hashFn hash.Hash) ([]byte, error) {
 	}
 
 	if !hmac.Equal(checksum, hashFn.Sum(nil)) {
-		return nil, fmt.Errorf("checksum validation failed")
+		return nil, ErrChecksumMismatch
 	}
 
 	return payload, nil
 }
+
+// ReadPayloadTo is the streaming form of ReadPayload: it copies the payload to
+// w in fixed-size chunks instead of buffering it, then verifies the tag. It
+// returns the payload length. Data reaches w before the tag is checked, so the
+// caller must discard whatever was written if an error is returned.
+func ReadPayloadTo(r io.Reader, w io.Writer, hashFn hash.Hash) (int64, error) {
+	sizeBytes := make([]byte, 4)
+	_, err := io.ReadFull(r, sizeBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read payload size: %w", err)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(sizeBytes))
+	buf := make([]byte, 1024)
+	for remaining := length; remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err = io.ReadFull(r, buf[:n]); err != nil {
+			return 0, fmt.Errorf("failed to read payload: %w", err)
+		}
+		hashFn.Write(buf[:n])
+		if _, err = w.Write(buf[:n]); err != nil {
+			return 0, err
+		}
+		remaining -= n
+	}
+
+	checksum := make([]byte, hashFn.Size())
+	_, err = io.ReadFull(r, checksum)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	if !hmac.Equal(checksum, hashFn.Sum(nil)) {
+		return 0, ErrChecksumMismatch
+	}
+
+	return length, nil
+}
@@ -28,6 +28,28 @@ func TestContainerRoundTrip(t *testing.T) {
 	assert.Equal(t, payload, readData)
 }
 
+func TestReadPayloadTo(t *testing.T) {
+	payload := bytes.Repeat([]byte("streamed "), 500) // spans several internal chunks
+	buf := testutil.NewMemReadWriteSeeker(nil)
+
+	err := container.WritePayload(buf, bytes.NewReader(payload), md5.New())
+	require.NoError(t, err)
+
+	buf.Seek(0, io.SeekStart)
+	var out bytes.Buffer
+	n, err := container.ReadPayloadTo(buf, &out, md5.New())
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(payload)), n)
+	assert.Equal(t, payload, out.Bytes())
+
+	// Corrupt the first payload byte: the copy still happens, but the tag fails.
+	buf.Seek(4, io.SeekStart)
+	buf.Write([]byte{payload[0] ^ 0xFF})
+	buf.Seek(0, io.SeekStart)
+	_, err = container.ReadPayloadTo(buf, io.Discard, md5.New())
+	assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+}
+
 func TestEmptyPayload(t *testing.T) {
 	payload := []byte{}
 	buf := testutil.NewMemReadWriteSeeker(nil)
@@ -58,6 +80,7 @@ func TestChecksumMismatch(t *testing.T) {
 	_, err = container.ReadPayload(buf, md5.New())
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "checksum")
+	assert.ErrorIs(t, err, container.ErrChecksumMismatch)
 }
 
 func TestTruncatedData(t *testing.T) {
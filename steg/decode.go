@@ -1,50 +1,35 @@
 package steg
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
+	"context"
 	"image/draw"
-	"io"
-
-	"github.com/pableeee/steg/cipher"
-	"github.com/pableeee/steg/cursors"
-	"github.com/pableeee/steg/steg/container"
+	"slices"
 )
 
-func Decode(m draw.Image, pass []byte, bitsPerChannel, channels int) ([]byte, error) {
-	seed, err := deriveSeed(pass)
-	if err != nil {
-		return nil, err
-	}
-
-	cur := cursors.NewRNGCursor(m, cursorOptions(seed, bitsPerChannel, channels)...)
-
-	// Read the 16-byte random salt from image bytes 0–15 (stored in plaintext).
-	saltAdapter := cursors.CursorAdapter(cur)
-	var randomSalt [16]byte
-	if _, err = io.ReadFull(saltAdapter, randomSalt[:]); err != nil {
-		return nil, err
-	}
+// Decode extracts the payload that Encode or EncodeParallel embedded in m
+// with the same password and settings. It runs a Decoder with one worker; a
+// WithWorkers option overrides the count, and the positional settings
+// override any given as options.
+func Decode(m draw.Image, pass []byte, bitsPerChannel, channels int, opts ...Option) ([]byte, error) {
+	return DecodeContext(context.Background(), m, pass, bitsPerChannel, channels, opts...)
+}
 
-	// Derive main keys from the recovered salt; seek cursor and cipher to bit 128.
-	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
-	if err != nil {
-		return nil, err
-	}
-	payloadCipher, err := cipher.NewCipher(payloadNonce, encKey)
-	if err != nil {
-		return nil, err
-	}
-	payloadCM := cursors.CipherMiddleware(cur, payloadCipher)
-	if _, err = payloadCM.Seek(128, io.SeekStart); err != nil {
-		return nil, err
-	}
+// DecodeContext is Decode with cancellation: once ctx is done it stops within
+// a chunk and returns ctx.Err(). Progress is reported to the callback set by
+// WithProgress.
+func DecodeContext(ctx context.Context, m draw.Image, pass []byte,
+	bitsPerChannel, channels int, opts ...Option) ([]byte, error) {
+	opts = slices.Concat([]Option{WithWorkers(1)}, opts, []Option{
+		WithBitsPerChannel(bitsPerChannel), WithChannels(channels),
+	})
+	return decodeWith(ctx, m, pass, opts)
+}
 
-	adapter := cursors.CursorAdapter(payloadCM)
-	mac := hmac.New(sha256.New, macKey)
-	padded, err := container.ReadPayload(adapter, mac)
+// decodeWith decodes with a one-off Decoder configured by opts.
+func decodeWith(ctx context.Context, m draw.Image, pass []byte, opts []Option) ([]byte, error) {
+	dec, err := NewDecoder(opts...)
 	if err != nil {
 		return nil, err
 	}
-	return extractRealPayload(padded)
+	return dec.Decode(ctx, m, pass)
 }
@@ -0,0 +1,122 @@
+package steg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"image/draw"
+	"io"
+
+	"github.com/pableeee/steg/cursors"
+	"github.com/pableeee/steg/steg/container"
+)
+
+// Decoder extracts payloads from images with a fixed set of options. Like
+// Encoder it holds no state between calls and may be used concurrently. Its
+// bits per channel, channels, traversal and slot permutation must match the
+// ones the image was encoded with; the worker count need not.
+type Decoder struct {
+	cfg config
+}
+
+// NewDecoder returns a Decoder configured by opts, or an error if an option
+// is out of range. The defaults are those of NewEncoder.
+func NewDecoder(opts ...Option) (*Decoder, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Decoder{cfg: *cfg}, nil
+}
+
+// Decode extracts and authenticates the payload embedded in m. A wrong
+// password or mismatched option fails, most often with
+// container.ErrChecksumMismatch; no unauthenticated data is returned. Once
+// ctx is done it stops within a chunk and returns ctx.Err(). Worker failures
+// are handled as in Encoder.Encode.
+func (d *Decoder) Decode(ctx context.Context, m draw.Image, pass []byte) ([]byte, error) {
+	cfg := &d.cfg
+	bpc, channels := cfg.bitsPerChannel, cfg.channels
+	tr, err := cfg.pixelTraversal(m, pass)
+	if err != nil {
+		return nil, err
+	}
+	slotKey := cfg.slotKey(pass)
+
+	// Read the 16-byte random salt from image bytes 0–15 (stored in plaintext).
+	rawCur := cursors.NewRNGCursor(m, cursorOptions(tr, slotKey, bpc, channels)...)
+	var randomSalt [16]byte
+	if _, err = io.ReadFull(cursors.CursorAdapter(rawCur), randomSalt[:]); err != nil {
+		return nil, err
+	}
+
+	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	newStack := func() (io.ReadWriteSeeker, error) {
+		return newWorkerStack(m, payloadNonce, encKey, tr, slotKey, bpc, channels)
+	}
+
+	// Check the 4-byte container length field at byte 16. A wrong key decrypts
+	// it to a random value; that is rejected here rather than read to the end
+	// of the image.
+	stack, err := newStack()
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.checkContainerLen(stack, m); err != nil {
+		return nil, err
+	}
+	paddedLen := int64(imageCapacityBytes(m, bpc, channels)) + 4
+	layout := newChunkLayout(m, bpc, channels)
+	blockLen, progLen := paddedLen+32, paddedLen
+	if cfg.randomAccess {
+		blockLen, progLen = layout.streamLen(), layout.streamLen()
+	}
+
+	// Extract the block in chunks aligned to absolute stream offsets, as
+	// Encoder.Encode embeds them. Progress counts the padded data only, with
+	// the chunk tags among it in the random-access layout.
+	buf := make([]byte, blockLen)
+	prog := cfg.newProgress(progLen)
+	progEnd := dataStart + progLen
+	err = cfg.runChunks(ctx, dataStart, dataStart+int64(len(buf)), chunkBytes(bpc, channels),
+		func() (func(chunk) error, error) {
+			stack, err := newStack()
+			if err != nil {
+				return nil, err
+			}
+			return func(c chunk) error {
+				if _, err := stack.Seek(c.from, io.SeekStart); err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(stack, buf[c.from-dataStart:c.to-dataStart]); err != nil {
+					return fmt.Errorf("failed to read payload: %w", err)
+				}
+				prog.add(min(c.to, progEnd) - c.from)
+				return nil
+			}, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.randomAccess {
+		padded, err := layout.unframe(buf, macKey)
+		if err != nil {
+			return nil, err
+		}
+		return extractRealPayload(padded)
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(buf[:paddedLen])
+	if !hmac.Equal(mac.Sum(nil), buf[paddedLen:]) {
+		return nil, container.ErrChecksumMismatch
+	}
+	return extractRealPayload(buf[:paddedLen])
+}
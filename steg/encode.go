@@ -1,66 +1,36 @@
 package steg
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/rand"
-	"crypto/sha256"
+	"context"
 	"image/draw"
 	"io"
-
-	"github.com/pableeee/steg/cipher"
-	"github.com/pableeee/steg/cursors"
-	"github.com/pableeee/steg/steg/container"
+	"slices"
 )
 
-func Encode(m draw.Image, pass []byte, r io.Reader, bitsPerChannel, channels int) error {
-	seed, err := deriveSeed(pass)
-	if err != nil {
-		return err
-	}
-
-	realPayload, err := io.ReadAll(r)
-	if err != nil {
-		return err
-	}
-	padded, err := buildPaddedPayload(m, realPayload, bitsPerChannel, channels)
-	if err != nil {
-		return err
-	}
-
-	cur := cursors.NewRNGCursor(m, cursorOptions(seed, bitsPerChannel, channels)...)
+// Encode encrypts the contents of r and embeds them into m, using the lowest
+// bitsPerChannel bits of the first channels channels of each pixel. It runs
+// an Encoder with one worker; a WithWorkers option overrides the count, and
+// the positional settings override any given as options.
+func Encode(m draw.Image, pass []byte, r io.Reader, bitsPerChannel, channels int, opts ...Option) error {
+	return EncodeContext(context.Background(), m, pass, r, bitsPerChannel, channels, opts...)
+}
 
-	// Generate a random per-encode salt and write it in plaintext to image bytes
-	// 0–15 (bits 0–127). The salt does not need to be secret; its purpose is
-	// uniqueness so that each encode derives independent main keys.
-	var randomSalt [16]byte
-	if _, err = rand.Read(randomSalt[:]); err != nil {
-		return err
-	}
-	saltAdapter := cursors.CursorAdapter(cur)
-	if _, err = saltAdapter.Write(randomSalt[:]); err != nil {
-		return err
-	}
+// EncodeContext is Encode with cancellation: once ctx is done it stops within
+// a chunk and returns ctx.Err(), leaving m partly written. Progress is
+// reported to the callback set by WithProgress.
+func EncodeContext(ctx context.Context, m draw.Image, pass []byte, r io.Reader,
+	bitsPerChannel, channels int, opts ...Option) error {
+	opts = slices.Concat([]Option{WithWorkers(1)}, opts, []Option{
+		WithBitsPerChannel(bitsPerChannel), WithChannels(channels),
+	})
+	return encodeWith(ctx, m, pass, r, opts)
+}
 
-	// Derive main keys from the random salt; seek cursor and cipher to bit 128.
-	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
+// encodeWith encodes with a one-off Encoder configured by opts.
+func encodeWith(ctx context.Context, m draw.Image, pass []byte, r io.Reader, opts []Option) error {
+	enc, err := NewEncoder(opts...)
 	if err != nil {
 		return err
 	}
-	payloadCipher, err := cipher.NewCipher(payloadNonce, encKey)
-	if err != nil {
-		return err
-	}
-	payloadCM := cursors.CipherMiddleware(cur, payloadCipher)
-	if _, err = payloadCM.Seek(128, io.SeekStart); err != nil {
-		return err
-	}
-
-	adapter := cursors.CursorAdapter(payloadCM)
-	mac := hmac.New(sha256.New, macKey)
-	if err = container.WritePayload(adapter, bytes.NewReader(padded), mac); err != nil {
-		return err
-	}
-	cur.Flush()
-	return nil
+	return enc.Encode(ctx, m, pass, r)
 }
@@ -0,0 +1,144 @@
+package steg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"image/draw"
+	"io"
+
+	"github.com/pableeee/steg/cursors"
+)
+
+// Encoder embeds payloads into images with a fixed set of options. It holds no
+// state between calls, so one Encoder may encode many images, concurrently
+// too; a progress callback given as an option is shared by them.
+type Encoder struct {
+	cfg config
+}
+
+// NewEncoder returns an Encoder configured by opts, or an error if an option
+// is out of range. Without options it embeds in 1 bit of each of R, G and B,
+// in the Fisher-Yates traversal, with up to GOMAXPROCS workers.
+func NewEncoder(opts ...Option) (*Encoder, error) {
+	cfg := newConfig(opts)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Encoder{cfg: *cfg}, nil
+}
+
+// Encode encrypts the contents of r and embeds them into m, filling the
+// image's whole capacity with padding. Once ctx is done it stops within a
+// chunk and returns ctx.Err(), leaving m partly written.
+//
+// With more than one worker, m must allow concurrent writes to distinct
+// pixels, as the image types of the standard library do. The first worker to
+// fail, or to panic in a method of m, stops the others; the errors of every
+// failed worker are returned joined with errors.Join.
+func (e *Encoder) Encode(ctx context.Context, m draw.Image, pass []byte, r io.Reader) error {
+	cfg := &e.cfg
+	bpc, channels := cfg.bitsPerChannel, cfg.channels
+	tr, err := cfg.pixelTraversal(m, pass)
+	if err != nil {
+		return err
+	}
+	slotKey := cfg.slotKey(pass)
+
+	realPayload, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	padded, err := buildPaddedPayload(realPayload, cfg.capacity(m))
+	if err != nil {
+		return err
+	}
+
+	// Generate a random per-encode salt and write it in plaintext to image bytes
+	// 0–15 (bits 0–127). The salt does not need to be secret; its purpose is
+	// uniqueness so that each encode derives independent main keys.
+	rawCur := cursors.NewRNGCursor(m, cursorOptions(tr, slotKey, bpc, channels)...)
+	var randomSalt [16]byte
+	if _, err = io.ReadFull(randReader, randomSalt[:]); err != nil {
+		return err
+	}
+	if _, err = cursors.CursorAdapter(rawCur).Write(randomSalt[:]); err != nil {
+		return err
+	}
+	rawCur.Flush()
+
+	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	// The tags are computed before the block is embedded in whatever order
+	// the workers take its chunks. The single tag covers the whole padded
+	// payload and follows it; in the random-access layout the block carries a
+	// tag after every chunk.
+	block, tag := padded, []byte(nil)
+	if cfg.randomAccess {
+		block = newChunkLayout(m, bpc, channels).frame(padded, macKey)
+	} else {
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write(padded)
+		tag = mac.Sum(nil)
+	}
+
+	// Embed the block in chunks aligned to absolute stream offsets, so that
+	// chunk boundaries are pixel boundaries. The pixels the first and last
+	// chunks share with the length field and the tag are finished below, once
+	// every chunk is done.
+	blockLen := int64(len(block))
+	prog := cfg.newProgress(blockLen)
+	newStack := func() (io.ReadWriteSeeker, error) {
+		return newWorkerStack(m, payloadNonce, encKey, tr, slotKey, bpc, channels)
+	}
+	err = cfg.runChunks(ctx, dataStart, dataStart+blockLen, chunkBytes(bpc, channels),
+		func() (func(chunk) error, error) {
+			stack, err := newStack()
+			if err != nil {
+				return nil, err
+			}
+			return func(c chunk) error {
+				if _, err := stack.Seek(c.from, io.SeekStart); err != nil {
+					return err
+				}
+				if _, err := stack.Write(block[c.from-dataStart : c.to-dataStart]); err != nil {
+					return err
+				}
+				prog.add(c.to - c.from)
+				return nil
+			}, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	// Container length field (byte 16) and single tag, under the payload
+	// cipher; the salt region (bytes 0–15) is already written.
+	stack, err := newStack()
+	if err != nil {
+		return err
+	}
+	if _, err = stack.Seek(16, io.SeekStart); err != nil {
+		return err
+	}
+	lenBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBuf, cfg.containerLen(m))
+	if _, err = stack.Write(lenBuf); err != nil {
+		return err
+	}
+	if tag == nil {
+		return nil
+	}
+	if _, err = stack.Seek(dataStart+blockLen, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = stack.Write(tag)
+	return err
+}
@@ -0,0 +1,83 @@
+package steg_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"testing"
+
+	"github.com/pableeee/steg/steg"
+	"github.com/pableeee/steg/steg/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	ctx := context.Background()
+	pass := []byte("encoder-pass")
+	opts := []steg.Option{steg.WithBitsPerChannel(2), steg.WithChannels(2), steg.WithTraversal(steg.TraversalFeistel)}
+
+	enc, err := steg.NewEncoder(opts...)
+	require.NoError(t, err)
+	for _, workers := range []int{0, 1, 3} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			payload := []byte(fmt.Sprintf("payload for %d workers", workers))
+			img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+			require.NoError(t, enc.Encode(ctx, img, pass, bytes.NewReader(payload)))
+
+			dec, err := steg.NewDecoder(append(opts, steg.WithWorkers(workers))...)
+			require.NoError(t, err)
+			got, err := dec.Decode(ctx, img, pass)
+			require.NoError(t, err)
+			assert.Equal(t, payload, got)
+
+			// The wrappers read the same layout.
+			got, err = steg.Decode(img, pass, 2, 2, steg.WithTraversal(steg.TraversalFeistel))
+			require.NoError(t, err)
+			assert.Equal(t, payload, got)
+
+			_, err = dec.Decode(ctx, img, []byte("wrong"))
+			assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+		})
+	}
+}
+
+func TestEncoderOptionValidation(t *testing.T) {
+	for _, tc := range []struct {
+		opt  steg.Option
+		want string
+	}{
+		{steg.WithBitsPerChannel(0), "bits per channel must be between 1 and 8, got 0"},
+		{steg.WithBitsPerChannel(9), "bits per channel must be between 1 and 8, got 9"},
+		{steg.WithChannels(0), "channels must be between 1 and 3, got 0"},
+		{steg.WithChannels(4), "channels must be between 1 and 3, got 4"},
+		{steg.WithWorkers(-1), "workers must not be negative, got -1"},
+		{steg.WithTraversal(steg.Traversal(99)), "unknown traversal Traversal(99)"},
+	} {
+		_, err := steg.NewEncoder(tc.opt)
+		assert.EqualError(t, err, "steg: "+tc.want)
+		_, err = steg.NewDecoder(tc.opt)
+		assert.EqualError(t, err, "steg: "+tc.want)
+	}
+
+	// The positional functions validate their parameters the same way, and
+	// the parameters take precedence over options.
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	err := steg.Encode(img, []byte("pass"), bytes.NewReader(nil), 9, 3)
+	assert.EqualError(t, err, "steg: bits per channel must be between 1 and 8, got 9")
+	require.NoError(t, steg.Encode(img, []byte("pass"), bytes.NewReader([]byte("x")), 2, 3, steg.WithBitsPerChannel(1)))
+	got, err := steg.DecodeParallel(img, []byte("pass"), 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("x"), got)
+
+	// A WithWorkers option overrides the sequential functions' single worker.
+	err = steg.Encode(img, []byte("pass"), bytes.NewReader(nil), 2, 3, steg.WithWorkers(-1))
+	assert.EqualError(t, err, "steg: workers must not be negative, got -1")
+	_, err = steg.Decode(img, []byte("pass"), 2, 3, steg.WithWorkers(-1))
+	assert.EqualError(t, err, "steg: workers must not be negative, got -1")
+	require.NoError(t, steg.Encode(img, []byte("pass"), bytes.NewReader([]byte("y")), 2, 3, steg.WithWorkers(3)))
+	got, err = steg.Decode(img, []byte("pass"), 2, 3, steg.WithWorkers(3))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("y"), got)
+}
@@ -0,0 +1,145 @@
+package steg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/draw"
+	"io"
+
+	"github.com/pableeee/steg/steg/container"
+)
+
+// config holds the settings of an Encoder or Decoder, and the optional
+// settings of the functions that wrap them.
+type config struct {
+	bitsPerChannel int
+	channels       int
+	workers        int
+	traversal      Traversal
+	permuteSlots   bool
+	randomAccess   bool
+	progress       ProgressFunc
+}
+
+// Option configures an Encoder or Decoder, or the optional behaviour of the
+// encode and decode functions.
+type Option func(*config)
+
+// WithBitsPerChannel sets how many least significant bits of each channel
+// carry the payload, from 1 (the default) to 8. The encode and decode
+// functions take it as a parameter instead.
+func WithBitsPerChannel(n int) Option {
+	return func(c *config) { c.bitsPerChannel = n }
+}
+
+// WithChannels sets which channels carry the payload: 1 = R, 2 = R+G or
+// 3 = R+G+B (the default). The encode and decode functions take it as a
+// parameter instead.
+func WithChannels(n int) Option {
+	return func(c *config) { c.channels = n }
+}
+
+// WithWorkers sets how many goroutines embed or extract the payload. 1 works
+// on the calling goroutine. 0, the default, uses up to GOMAXPROCS, and fewer
+// when the payload spans only a few chunks. Every worker count produces the
+// same image.
+func WithWorkers(n int) Option {
+	return func(c *config) { c.workers = n }
+}
+
+// WithTraversal selects the pixel traversal. Decode with the traversal the
+// image was encoded with; the default is TraversalFisherYates.
+func WithTraversal(t Traversal) Option {
+	return func(c *config) { c.traversal = t }
+}
+
+// WithSlotPermutation fills the bit slots of each pixel in a password-keyed
+// order instead of channel by channel (see cursors.WithSlotKey). Like the
+// traversal it is not recorded in the image: decode with the setting used to
+// encode.
+func WithSlotPermutation() Option {
+	return func(c *config) { c.permuteSlots = true }
+}
+
+// WithRandomAccess embeds the padded payload in 4 KiB chunks, each with its
+// own tag, instead of under one tag, so that NewPayloadReader can read and
+// authenticate any range without reading the rest. It costs 32 bytes of
+// capacity per chunk. Like the traversal it is not recorded in the image:
+// decode with the setting used to encode.
+func WithRandomAccess() Option {
+	return func(c *config) { c.randomAccess = true }
+}
+
+// WithProgress makes the operation report its progress to fn. Only the
+// encode and decode functions report progress; Verify ignores it.
+func WithProgress(fn ProgressFunc) Option {
+	return func(c *config) { c.progress = fn }
+}
+
+// capacity returns the maximum real payload size of m in the configured
+// layout.
+func (c *config) capacity(m draw.Image) int {
+	if !c.randomAccess {
+		return imageCapacityBytes(m, c.bitsPerChannel, c.channels)
+	}
+	l := newChunkLayout(m, c.bitsPerChannel, c.channels)
+	return int(max(l.paddedLen-4, 0))
+}
+
+// containerLen returns the container length field of m in the configured
+// layout: the padded length, with randomAccessFlag set in the random-access
+// layout.
+func (c *config) containerLen(m draw.Image) uint32 {
+	if !c.randomAccess {
+		return uint32(imageCapacityBytes(m, c.bitsPerChannel, c.channels) + 4)
+	}
+	return uint32(newChunkLayout(m, c.bitsPerChannel, c.channels).paddedLen) | randomAccessFlag
+}
+
+// errContainerLength is returned when the container length does not match
+// the image. It wraps container.ErrChecksumMismatch, which decoding reports
+// for a wrong key, so that Verify can still tell it from a tag mismatch.
+var errContainerLength = fmt.Errorf("%w: container length does not match the image", container.ErrChecksumMismatch)
+
+// checkContainerLen reads the container length field from stack, a payload
+// stack of m, and checks it against containerLen. Every encode pads the
+// payload to capacity, so a wrong password or option shows as any other
+// value.
+func (c *config) checkContainerLen(stack io.ReadSeeker, m draw.Image) error {
+	if _, err := stack.Seek(16, io.SeekStart); err != nil {
+		return err
+	}
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(stack, lenBuf[:]); err != nil {
+		return fmt.Errorf("failed to read payload size: %w", err)
+	}
+	if binary.LittleEndian.Uint32(lenBuf[:]) != c.containerLen(m) {
+		return errContainerLength
+	}
+	return nil
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{bitsPerChannel: 1, channels: 3}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// validate reports the first setting out of range.
+func (c *config) validate() error {
+	if c.bitsPerChannel < 1 || c.bitsPerChannel > 8 {
+		return fmt.Errorf("steg: bits per channel must be between 1 and 8, got %d", c.bitsPerChannel)
+	}
+	if c.channels < 1 || c.channels > 3 {
+		return fmt.Errorf("steg: channels must be between 1 and 3, got %d", c.channels)
+	}
+	if c.workers < 0 {
+		return fmt.Errorf("steg: workers must not be negative, got %d", c.workers)
+	}
+	if _, ok := traversalNames[c.traversal]; !ok {
+		return fmt.Errorf("steg: unknown traversal %v", c.traversal)
+	}
+	return nil
+}
@@ -1,50 +1,28 @@
 package steg
 
 import (
-	"crypto/hmac"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
-	"image"
 	"image/draw"
 	"io"
 	"runtime"
+	"slices"
 	"sync"
 
 	"github.com/pableeee/steg/cipher"
 	"github.com/pableeee/steg/cursors"
 )
 
-type encJob struct {
-	streamOffset int64
-	data         []byte
-}
-
-type decJob struct {
-	streamOffset int64
-	dest         []byte
-}
+// dataStart is the stream offset of the padded payload: it follows the 16-byte
+// salt and the 4-byte container length field.
+const dataStart = 20
 
 // newWorkerStack creates a per-worker cipher+cursor stack. Each worker has its
-// own independent cipher and cursor state. imgMu, when non-nil, is shared
-// across concurrent workers to serialise img.At()/img.Set() calls.
+// own independent cipher and cursor state.
 func newWorkerStack(m draw.Image, nonce uint32, encKey []byte,
-	points []image.Point, bitsPerChannel, channels int, imgMu *sync.Mutex) (io.ReadWriteSeeker, error) {
-	opts := []cursors.Option{
-		cursors.WithSharedPoints(points),
-		cursors.WithBitsPerChannel(bitsPerChannel),
-	}
-	if channels >= 2 {
-		opts = append(opts, cursors.UseGreenBit())
-	}
-	if channels >= 3 {
-		opts = append(opts, cursors.UseBlueBit())
-	}
-	if imgMu != nil {
-		opts = append(opts, cursors.WithImageMutex(imgMu))
-	}
-	cur := cursors.NewRNGCursor(m, opts...)
+	tr cursors.Traversal, slotKey []byte, bitsPerChannel, channels int) (io.ReadWriteSeeker, error) {
+	cur := cursors.NewRNGCursor(m, cursorOptions(tr, slotKey, bitsPerChannel, channels)...)
 	c, err := cipher.NewCipher(nonce, encKey)
 	if err != nil {
 		return nil, err
@@ -52,249 +30,187 @@ func newWorkerStack(m draw.Image, nonce uint32, encKey []byte,
 	return cursors.CursorAdapter(cursors.CipherMiddleware(cur, c)), nil
 }
 
-// EncodeParallel encodes r into m using a parallel worker pool.
-// The on-image layout is identical to Encode, so DecodeParallel and Decode
-// can both decode images written by EncodeParallel (and vice-versa).
-func EncodeParallel(m draw.Image, pass []byte, r io.Reader, bitsPerChannel, channels int) error {
-	seed, err := deriveSeed(pass)
-	if err != nil {
-		return err
-	}
-
-	realPayload, err := io.ReadAll(r)
-	if err != nil {
-		return err
-	}
-	padded, err := buildPaddedPayload(m, realPayload, bitsPerChannel, channels)
-	if err != nil {
-		return err
-	}
-
-	bounds := m.Bounds()
-	points := cursors.GenerateSequence(bounds.Max.X, bounds.Max.Y, seed)
-
-	// Write plaintext salt (16 bytes) to image bytes 0–15 before workers start.
-	rawOpts := []cursors.Option{cursors.WithSharedPoints(points), cursors.WithBitsPerChannel(bitsPerChannel)}
-	if channels >= 2 {
-		rawOpts = append(rawOpts, cursors.UseGreenBit())
-	}
-	if channels >= 3 {
-		rawOpts = append(rawOpts, cursors.UseBlueBit())
-	}
-	rawCur := cursors.NewRNGCursor(m, rawOpts...)
-	var randomSalt [16]byte
-	if _, err = rand.Read(randomSalt[:]); err != nil {
-		return err
-	}
-	saltAdapter := cursors.CursorAdapter(rawCur)
-	if _, err = saltAdapter.Write(randomSalt[:]); err != nil {
-		return err
-	}
-	rawCur.Flush()
-
-	// Derive main keys from the random salt.
-	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
-	if err != nil {
-		return err
-	}
-
-	alignment := lcmBytes(8, channels*bitsPerChannel)
-	chunkSize := alignment * 1024
-
-	// Pre-compute HMAC over the full padded block before dispatching workers.
-	hashFn := hmac.New(sha256.New, macKey)
-	hashFn.Write(padded)
-	tag := hashFn.Sum(nil)
-
-	// Shared mutex serialises img.At()/img.Set() across concurrent workers.
-	imgMu := &sync.Mutex{}
+// chunkBytes returns the stream length of one parallel job: 1024 times the
+// smallest run of whole bytes that is also a run of whole pixels. Chunks must
+// end on pixel boundaries because a worker rewrites every pixel it touches,
+// and because with a slot permutation the bits of one byte are scattered over
+// the slots of its pixels: only whole pixels map to a known set of bytes.
+func chunkBytes(bitsPerChannel, channels int) int64 {
+	return int64(lcmBytes(8, channels*bitsPerChannel) * 1024)
+}
 
-	numWorkers := runtime.GOMAXPROCS(0)
-	jobChan := make(chan encJob, numWorkers*2)
-	errChan := make(chan error, numWorkers)
+// workerPool runs jobs on a fixed set of goroutines. The first failure of a
+// worker, a panic included, cancels the pool: submit stops accepting jobs and
+// the other workers return after their current one, so a failing pool never
+// leaves the producer blocked. wait reports every failure.
+type workerPool[J any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   chan J
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
 
-	var wg sync.WaitGroup
+// startPool starts numWorkers workers. Each calls newWorker once for its own
+// job handler, then runs it on jobs until the pool closes or fails.
+func startPool[J any](ctx context.Context, numWorkers int, newWorker func() (func(J) error, error)) *workerPool[J] {
+	poolCtx, cancel := context.WithCancel(ctx)
+	p := &workerPool[J]{ctx: poolCtx, cancel: cancel, jobs: make(chan J, numWorkers*2)}
 	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			adapter, werr := newWorkerStack(m, payloadNonce, encKey, points, bitsPerChannel, channels, imgMu)
-			if werr != nil {
-				errChan <- werr
-				return
-			}
-			for job := range jobChan {
-				if _, serr := adapter.Seek(job.streamOffset, io.SeekStart); serr != nil {
-					errChan <- serr
-					return
-				}
-				if _, werr2 := adapter.Write(job.data); werr2 != nil {
-					errChan <- werr2
-					return
-				}
-			}
-			if _, ferr := adapter.Seek(0, io.SeekStart); ferr != nil {
-				errChan <- ferr
-			}
-		}()
+		p.wg.Add(1)
+		go p.work(newWorker)
 	}
+	return p
+}
 
-	// Dispatch padded data in aligned chunks. streamOffset skips 16 bytes of
-	// encrypted salt + 4 bytes of container length field = byte 20.
-	totalLen := int64(len(padded))
-	var offset int64
-	for offset < totalLen {
-		end := offset + int64(chunkSize)
-		if end > totalLen {
-			end = totalLen
+func (p *workerPool[J]) work(newWorker func() (func(J) error, error)) {
+	defer p.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				p.fail(fmt.Errorf("steg: parallel worker panicked: %w", err))
+			} else {
+				p.fail(fmt.Errorf("steg: parallel worker panicked: %v", r))
+			}
 		}
-		chunk := make([]byte, end-offset)
-		copy(chunk, padded[offset:end])
-		jobChan <- encJob{streamOffset: 20 + offset, data: chunk}
-		offset = end
-	}
-	close(jobChan)
-	wg.Wait()
-
-	select {
-	case werr := <-errChan:
-		return werr
-	default:
-	}
-
-	// Post-parallel sequential writes: container length field (byte 16) and HMAC.
-	// Workers use payloadNonce; the salt region (bytes 0–15) is already written.
-	seqAdapter, err := newWorkerStack(m, payloadNonce, encKey, points, bitsPerChannel, channels, nil)
+	}()
+	do, err := newWorker()
 	if err != nil {
-		return err
-	}
-
-	if _, err = seqAdapter.Seek(16, io.SeekStart); err != nil {
-		return err
+		p.fail(err)
+		return
 	}
-	lenBuf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(lenBuf, uint32(totalLen))
-	if _, err = seqAdapter.Write(lenBuf); err != nil {
-		return err
-	}
-
-	if _, err = seqAdapter.Seek(20+totalLen, io.SeekStart); err != nil {
-		return err
-	}
-	if _, err = seqAdapter.Write(tag); err != nil {
-		return err
+	for job := range p.jobs {
+		if p.ctx.Err() != nil {
+			return
+		}
+		if err := do(job); err != nil {
+			p.fail(err)
+			return
+		}
 	}
-	_, err = seqAdapter.Seek(0, io.SeekStart)
-	return err
 }
 
-// DecodeParallel decodes a message from m using a parallel worker pool.
-// Images encoded by Encode (sequential) are fully compatible.
-func DecodeParallel(m draw.Image, pass []byte, bitsPerChannel, channels int) ([]byte, error) {
-	seed, err := deriveSeed(pass)
-	if err != nil {
-		return nil, err
-	}
-
-	bounds := m.Bounds()
-	points := cursors.GenerateSequence(bounds.Max.X, bounds.Max.Y, seed)
+// fail records err and cancels the pool.
+func (p *workerPool[J]) fail(err error) {
+	p.mu.Lock()
+	p.errs = append(p.errs, err)
+	p.mu.Unlock()
+	p.cancel()
+}
 
-	// Read the 16-byte random salt from image bytes 0–15 (stored in plaintext).
-	rawOpts := []cursors.Option{cursors.WithSharedPoints(points), cursors.WithBitsPerChannel(bitsPerChannel)}
-	if channels >= 2 {
-		rawOpts = append(rawOpts, cursors.UseGreenBit())
-	}
-	if channels >= 3 {
-		rawOpts = append(rawOpts, cursors.UseBlueBit())
+// submit queues job, blocking while the workers are busy. It returns the
+// pool's context error, without queueing, once a worker has failed or the
+// parent context is done.
+func (p *workerPool[J]) submit(job J) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
 	}
-	rawCur := cursors.NewRNGCursor(m, rawOpts...)
-	saltAdapter := cursors.CursorAdapter(rawCur)
-	var randomSalt [16]byte
-	if _, err = io.ReadFull(saltAdapter, randomSalt[:]); err != nil {
-		return nil, err
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
 	}
+}
 
-	// Derive main keys from the recovered salt.
-	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
-	if err != nil {
-		return nil, err
-	}
+// wait closes the pool to new jobs and waits for the workers. It returns the
+// workers' errors joined, or the parent context's error if the pool was only
+// cancelled, or nil.
+func (p *workerPool[J]) wait(parent context.Context) error {
+	close(p.jobs)
+	p.wg.Wait()
+	p.cancel()
+	if len(p.errs) > 0 {
+		return errors.Join(p.errs...)
+	}
+	return parent.Err()
+}
 
-	// Read the 4-byte container length field at byte 16 (after the encrypted salt).
-	seqAdapter, err := newWorkerStack(m, payloadNonce, encKey, points, bitsPerChannel, channels, nil)
-	if err != nil {
-		return nil, err
-	}
-	if _, err = seqAdapter.Seek(16, io.SeekStart); err != nil {
-		return nil, err
-	}
-	lenBuf := make([]byte, 4)
-	if _, err = io.ReadFull(seqAdapter, lenBuf); err != nil {
-		return nil, fmt.Errorf("failed to read payload length: %w", err)
+// forEachChunk calls f for consecutive ranges [from, to) covering [start, end),
+// split at every multiple of size, and stops at the first error f returns.
+// When size is a whole number of pixels, as chunkBytes is, the split points
+// are pixel boundaries, so no pixel is shared by two ranges.
+func forEachChunk(start, end, size int64, f func(from, to int64) error) error {
+	for from := start; from < end; {
+		to := min((from/size+1)*size, end)
+		if err := f(from, to); err != nil {
+			return err
+		}
+		from = to
 	}
-	payloadLen := int64(binary.LittleEndian.Uint32(lenBuf))
-
-	// Allocate buffer for padded data + HMAC tag.
-	totalRemaining := payloadLen + 32
-	decryptedBuf := make([]byte, totalRemaining)
-
-	alignment := lcmBytes(8, channels*bitsPerChannel)
-	chunkSize := int64(alignment * 1024)
-
-	numWorkers := runtime.GOMAXPROCS(0)
-	jobChan := make(chan decJob, numWorkers*2)
-	errChan := make(chan error, numWorkers)
+	return nil
+}
 
-	var wg sync.WaitGroup
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			adapter, werr := newWorkerStack(m, payloadNonce, encKey, points, bitsPerChannel, channels, nil)
-			if werr != nil {
-				errChan <- werr
-				return
-			}
-			for job := range jobChan {
-				if _, serr := adapter.Seek(job.streamOffset, io.SeekStart); serr != nil {
-					errChan <- serr
-					return
-				}
-				if _, rerr := io.ReadFull(adapter, job.dest); rerr != nil {
-					errChan <- rerr
-					return
-				}
+// chunk is the stream range [from, to) of one job.
+type chunk struct{ from, to int64 }
+
+// runChunks runs the handlers made by newWorker over the chunks of
+// [start, end) split by forEachChunk. With one worker it runs on the calling
+// goroutine, checking ctx between chunks; otherwise each of the workers makes
+// its own handler and takes chunks from a workerPool.
+func (c *config) runChunks(ctx context.Context, start, end, size int64,
+	newWorker func() (func(chunk) error, error)) error {
+	workers := c.workers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = int(min(int64(workers), (end-start+size-1)/size))
+	if workers <= 1 {
+		do, err := newWorker()
+		if err != nil {
+			return err
+		}
+		return forEachChunk(start, end, size, func(from, to int64) error {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-		}()
+			return do(chunk{from, to})
+		})
 	}
 
-	// Dispatch aligned chunks; streamOffset skips 16 (enc salt) + 4 (length) = byte 20.
-	var offset int64
-	for offset < totalRemaining {
-		size := chunkSize
-		if offset+size > totalRemaining {
-			size = totalRemaining - offset
-		}
-		dest := decryptedBuf[offset : offset+size]
-		jobChan <- decJob{streamOffset: 20 + offset, dest: dest}
-		offset += size
-	}
-	close(jobChan)
-	wg.Wait()
+	pool := startPool(ctx, workers, newWorker)
+	// Dispatch stops early if a worker fails or ctx is done; wait reports why.
+	forEachChunk(start, end, size, func(from, to int64) error {
+		return pool.submit(chunk{from, to})
+	})
+	return pool.wait(ctx)
+}
 
-	select {
-	case werr := <-errChan:
-		return nil, werr
-	default:
-	}
+// EncodeParallel encodes r into m using a parallel worker pool.
+// The on-image layout is identical to Encode, so DecodeParallel and Decode
+// can both decode images written by EncodeParallel (and vice-versa).
+//
+// It runs an Encoder with up to GOMAXPROCS workers (see Encoder.Encode for
+// how workers share m and fail); a WithWorkers option overrides the count.
+func EncodeParallel(m draw.Image, pass []byte, r io.Reader, bitsPerChannel, channels int, opts ...Option) error {
+	return EncodeParallelContext(context.Background(), m, pass, r, bitsPerChannel, channels, opts...)
+}
 
-	// Verify HMAC over the full padded block.
-	mac := hmac.New(sha256.New, macKey)
-	mac.Write(decryptedBuf[:payloadLen])
-	expected := mac.Sum(nil)
-	if !hmac.Equal(expected, decryptedBuf[payloadLen:]) {
-		return nil, fmt.Errorf("checksum validation failed")
-	}
+// EncodeParallelContext is EncodeParallel with cancellation: once ctx is done
+// the workers stop after their current chunk and it returns ctx.Err(), leaving
+// m partly written. Progress is reported to the callback set by WithProgress.
+func EncodeParallelContext(ctx context.Context, m draw.Image, pass []byte, r io.Reader,
+	bitsPerChannel, channels int, opts ...Option) error {
+	opts = slices.Concat([]Option{WithWorkers(0)}, opts,
+		[]Option{WithBitsPerChannel(bitsPerChannel), WithChannels(channels)})
+	return encodeWith(ctx, m, pass, r, opts)
+}
+
+// DecodeParallel decodes a message from m using a parallel worker pool.
+// Images encoded by Encode (sequential) are fully compatible. Like
+// EncodeParallel, it runs a Decoder with up to GOMAXPROCS workers.
+func DecodeParallel(m draw.Image, pass []byte, bitsPerChannel, channels int, opts ...Option) ([]byte, error) {
+	return DecodeParallelContext(context.Background(), m, pass, bitsPerChannel, channels, opts...)
+}
 
-	return extractRealPayload(decryptedBuf[:payloadLen])
+// DecodeParallelContext is DecodeParallel with cancellation: once ctx is done
+// the workers stop after their current chunk and it returns ctx.Err().
+// Progress is reported to the callback set by WithProgress.
+func DecodeParallelContext(ctx context.Context, m draw.Image, pass []byte,
+	bitsPerChannel, channels int, opts ...Option) ([]byte, error) {
+	opts = slices.Concat([]Option{WithWorkers(0)}, opts,
+		[]Option{WithBitsPerChannel(bitsPerChannel), WithChannels(channels)})
+	return decodeWith(ctx, m, pass, opts)
 }
@@ -0,0 +1,167 @@
+package steg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected pixel fault")
+
+// faultyImage is an RGBA image whose pixel methods panic with errInjected
+// once failAfter calls have been made, as an image backed by failing storage
+// might. Not being an *image.RGBA, it is always reached through At and Set.
+type faultyImage struct {
+	*image.RGBA
+	calls     atomic.Int64
+	failAfter int64
+}
+
+func (f *faultyImage) check() {
+	if f.calls.Add(1) > f.failAfter {
+		panic(errInjected)
+	}
+}
+
+func (f *faultyImage) At(x, y int) color.Color {
+	f.check()
+	return f.RGBA.At(x, y)
+}
+
+func (f *faultyImage) Set(x, y int, c color.Color) {
+	f.check()
+	f.RGBA.Set(x, y, c)
+}
+
+// returnsWithin runs f and fails the test if it has not returned after d.
+func returnsWithin[T any](t *testing.T, d time.Duration, f func() T) T {
+	t.Helper()
+	done := make(chan T, 1)
+	go func() { done <- f() }()
+	select {
+	case v := <-done:
+		return v
+	case <-time.After(d):
+		t.Fatal("parallel call deadlocked")
+		panic("unreachable")
+	}
+}
+
+// assertInjected checks that err joins one or more worker failures, all of
+// them the injected fault.
+func assertInjected(t *testing.T, err error) {
+	t.Helper()
+	require.ErrorIs(t, err, errInjected)
+	var joined interface{ Unwrap() []error }
+	require.ErrorAs(t, err, &joined)
+	for _, e := range joined.Unwrap() {
+		assert.ErrorIs(t, e, errInjected)
+		assert.ErrorContains(t, e, "worker panicked")
+	}
+}
+
+// TestParallelWorkerFault makes every worker fail on a carrier with many more
+// chunks than the job queue holds, the case in which the producer used to
+// block forever.
+func TestParallelWorkerFault(t *testing.T) {
+	const workers = 4
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+	pass := []byte("fault-pass")
+	payload := []byte("never fully written")
+	// 600x400 pixels at 3 bits each make 30 chunks of 3 KiB. The first 1000
+	// pixel calls cover the salt and header, written or read sequentially.
+	const failAfter = 1000
+
+	t.Run("encode", func(t *testing.T) {
+		img := &faultyImage{RGBA: image.NewRGBA(image.Rect(0, 0, 600, 400)), failAfter: failAfter}
+		err := returnsWithin(t, 30*time.Second, func() error {
+			return EncodeParallel(img, pass, bytes.NewReader(payload), 1, 3)
+		})
+		assertInjected(t, err)
+		// Each worker fails on its first call past the limit, and no chunk is
+		// dispatched after that.
+		assert.LessOrEqual(t, img.calls.Load(), int64(failAfter+workers))
+	})
+
+	t.Run("decode", func(t *testing.T) {
+		rgba := image.NewRGBA(image.Rect(0, 0, 600, 400))
+		require.NoError(t, Encode(rgba, pass, bytes.NewReader(payload), 1, 3))
+		img := &faultyImage{RGBA: rgba, failAfter: failAfter}
+		err := returnsWithin(t, 30*time.Second, func() error {
+			_, err := DecodeParallel(img, pass, 1, 3)
+			return err
+		})
+		assertInjected(t, err)
+		assert.LessOrEqual(t, img.calls.Load(), int64(failAfter+workers))
+	})
+}
+
+func TestWorkerPool(t *testing.T) {
+	t.Run("joins every failure", func(t *testing.T) {
+		const workers = 4
+		var started sync.WaitGroup
+		started.Add(workers)
+		pool := startPool(context.Background(), workers, func() (func(int) error, error) {
+			return func(job int) error {
+				// Fail only once every worker holds a job, so that all of
+				// them fail rather than being cancelled by the first.
+				started.Done()
+				started.Wait()
+				return fmt.Errorf("job %d failed", job)
+			}, nil
+		})
+		for i := 0; i < workers; i++ {
+			require.NoError(t, pool.submit(i))
+		}
+		err := pool.wait(context.Background())
+		for i := 0; i < workers; i++ {
+			assert.ErrorContains(t, err, fmt.Sprintf("job %d failed", i))
+		}
+	})
+
+	t.Run("stops dispatch when every worker fails", func(t *testing.T) {
+		errSetup := errors.New("setup failed")
+		pool := startPool(context.Background(), 2, func() (func(int) error, error) {
+			return nil, errSetup
+		})
+		submitted := returnsWithin(t, 10*time.Second, func() int {
+			for i := 0; ; i++ {
+				if pool.submit(i) != nil {
+					return i
+				}
+			}
+		})
+		assert.Less(t, submitted, 1000)
+		err := pool.wait(context.Background())
+		assert.ErrorIs(t, err, errSetup)
+	})
+
+	t.Run("recovers panics", func(t *testing.T) {
+		pool := startPool(context.Background(), 1, func() (func(int) error, error) {
+			return func(int) error { panic("boom") }, nil
+		})
+		require.NoError(t, pool.submit(0))
+		assert.EqualError(t, pool.wait(context.Background()), "steg: parallel worker panicked: boom")
+	})
+
+	t.Run("parent cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		pool := startPool(ctx, 2, func() (func(int) error, error) {
+			return func(int) error { return nil }, nil
+		})
+		cancel()
+		assert.ErrorIs(t, pool.submit(0), context.Canceled)
+		assert.ErrorIs(t, pool.wait(ctx), context.Canceled)
+	})
+}
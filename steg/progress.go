@@ -0,0 +1,42 @@
+package steg
+
+import "sync"
+
+// ProgressFunc receives the progress of an encode or decode: done of total
+// bytes of the padded payload (the real payload, its length prefix and the
+// random padding, with the chunk tags under WithRandomAccess) have been
+// embedded or extracted. It is called once with
+// done = 0 when the total is known, then after every chunk, ending with
+// done = total on success. Calls are serialised, also in the parallel
+// variants, and done never decreases; the callback should return quickly.
+type ProgressFunc func(done, total int64)
+
+// progress accumulates the bytes processed by one operation and reports them
+// to a ProgressFunc. A nil *progress ignores every call.
+type progress struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	done  int64
+	total int64
+}
+
+// newProgress returns the progress of an operation over total bytes, or nil
+// when no callback is configured.
+func (c *config) newProgress(total int64) *progress {
+	if c.progress == nil {
+		return nil
+	}
+	c.progress(0, total)
+	return &progress{fn: c.progress, total: total}
+}
+
+// add records n more bytes processed.
+func (p *progress) add(n int64) {
+	if p == nil || n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	p.fn(p.done, p.total)
+}
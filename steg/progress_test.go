@@ -0,0 +1,122 @@
+package steg_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"testing"
+
+	"github.com/pableeee/steg/steg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contextOps runs each encode/decode pair of the API through its Context
+// variant.
+var contextOps = []struct {
+	name   string
+	encode func(ctx context.Context, m draw.Image, payload []byte, opts ...steg.Option) error
+	decode func(ctx context.Context, m draw.Image, opts ...steg.Option) ([]byte, error)
+}{
+	{
+		"sequential",
+		func(ctx context.Context, m draw.Image, payload []byte, opts ...steg.Option) error {
+			return steg.EncodeContext(ctx, m, []byte("progress"), bytes.NewReader(payload), 1, 3, opts...)
+		},
+		func(ctx context.Context, m draw.Image, opts ...steg.Option) ([]byte, error) {
+			return steg.DecodeContext(ctx, m, []byte("progress"), 1, 3, opts...)
+		},
+	},
+	{
+		"parallel",
+		func(ctx context.Context, m draw.Image, payload []byte, opts ...steg.Option) error {
+			return steg.EncodeParallelContext(ctx, m, []byte("progress"), bytes.NewReader(payload), 1, 3, opts...)
+		},
+		func(ctx context.Context, m draw.Image, opts ...steg.Option) ([]byte, error) {
+			return steg.DecodeParallelContext(ctx, m, []byte("progress"), 1, 3, opts...)
+		},
+	},
+}
+
+// progressLog records the calls of a ProgressFunc.
+type progressLog struct{ done, total []int64 }
+
+func (l *progressLog) option() steg.Option {
+	return steg.WithProgress(func(done, total int64) {
+		l.done = append(l.done, done)
+		l.total = append(l.total, total)
+	})
+}
+
+func (l *progressLog) check(t *testing.T, total int64) {
+	t.Helper()
+	require.NotEmpty(t, l.done)
+	assert.Equal(t, int64(0), l.done[0], "the first call reports the total before any work")
+	assert.Equal(t, total, l.done[len(l.done)-1], "the last call reports completion")
+	assert.IsNonDecreasing(t, l.done)
+	for _, tot := range l.total {
+		require.Equal(t, total, tot)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	// 400x400 pixels at 3 bits each: 60000 bytes, of which the padded payload
+	// is everything but the 16-byte salt, 4-byte length and 32-byte tag.
+	const total = 400*400*3/8 - 52
+	payload := []byte("progress report")
+	for _, op := range contextOps {
+		t.Run(op.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, 400, 400))
+			var enc, dec progressLog
+			require.NoError(t, op.encode(context.Background(), img, payload, enc.option()))
+			enc.check(t, total)
+
+			got, err := op.decode(context.Background(), img, dec.option())
+			require.NoError(t, err)
+			assert.Equal(t, payload, got)
+			dec.check(t, total)
+		})
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	payload := []byte("cancelled")
+	for _, op := range contextOps {
+		t.Run(op.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, 400, 400))
+			require.NoError(t, op.encode(context.Background(), img, payload))
+
+			done, cancel := context.WithCancel(context.Background())
+			cancel()
+			assert.ErrorIs(t, op.encode(done, image.NewRGBA(img.Rect), payload), context.Canceled)
+			_, err := op.decode(done, img)
+			assert.ErrorIs(t, err, context.Canceled)
+
+			// Cancelling from the first progress report stops the operation
+			// well before the end of the image.
+			var last int64
+			var total int64
+			cancelEarly := func(cancel context.CancelFunc) steg.Option {
+				return steg.WithProgress(func(done, tot int64) {
+					last, total = done, tot
+					if done > 0 {
+						cancel()
+					}
+				})
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err = op.encode(ctx, image.NewRGBA(img.Rect), payload, cancelEarly(cancel))
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Less(t, last, total)
+
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			_, err = op.decode(ctx, img, cancelEarly(cancel))
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Less(t, last, total)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package steg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/draw"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/pableeee/steg/cursors"
+)
+
+// PayloadReader gives random access to a payload embedded with
+// WithRandomAccess. Each read extracts and authenticates only the chunks its
+// range touches, so reading a few bytes of a large payload costs a few
+// chunks rather than the whole image. It keeps the last chunk it read, so
+// small sequential reads extract each chunk once. It is safe for concurrent
+// use; m must not change while it is read.
+type PayloadReader struct {
+	newStack func() (io.ReadWriteSeeker, error)
+	macKey   []byte
+	layout   chunkLayout
+	size     int64
+
+	mu       sync.Mutex
+	last     int64  // index of the last chunk read
+	lastData []byte // its authenticated data
+}
+
+// NewPayloadReader opens the payload embedded in m. WithRandomAccess is
+// implied; the other options are those of NewDecoder, of which workers and
+// progress are ignored. It authenticates the first chunk to learn the payload
+// size. A wrong password or mismatched option fails, most often with
+// container.ErrChecksumMismatch.
+func NewPayloadReader(m draw.Image, pass []byte, opts ...Option) (*PayloadReader, error) {
+	return openPayloadReader(m, pass, newConfig(slices.Concat(opts, []Option{WithRandomAccess()})))
+}
+
+func openPayloadReader(m draw.Image, pass []byte, cfg *config) (*PayloadReader, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	bpc, channels := cfg.bitsPerChannel, cfg.channels
+	tr, err := cfg.pixelTraversal(m, pass)
+	if err != nil {
+		return nil, err
+	}
+	slotKey := cfg.slotKey(pass)
+
+	// Read the 16-byte random salt from image bytes 0–15 (stored in plaintext).
+	rawCur := cursors.NewRNGCursor(m, cursorOptions(tr, slotKey, bpc, channels)...)
+	var randomSalt [16]byte
+	if _, err = io.ReadFull(cursors.CursorAdapter(rawCur), randomSalt[:]); err != nil {
+		return nil, err
+	}
+	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
+	if err != nil {
+		return nil, err
+	}
+	r := &PayloadReader{
+		newStack: func() (io.ReadWriteSeeker, error) {
+			return newWorkerStack(m, payloadNonce, encKey, tr, slotKey, bpc, channels)
+		},
+		macKey: macKey,
+		layout: newChunkLayout(m, bpc, channels),
+	}
+	if r.layout.chunks == 0 {
+		return nil, fmt.Errorf("steg: image too small to hold any payload")
+	}
+	stack, err := r.newStack()
+	if err != nil {
+		return nil, err
+	}
+
+	// The container length is not covered by a tag of its own, but the tags
+	// cover the padded length, so any other value is rejected here.
+	if err = cfg.checkContainerLen(stack, m); err != nil {
+		return nil, err
+	}
+
+	head, err := r.layout.readChunk(stack, macKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	r.last, r.lastData = 0, head
+	r.size = int64(binary.LittleEndian.Uint32(head[:4]))
+	if r.size > r.layout.paddedLen-4 {
+		return nil, fmt.Errorf("steg: corrupt payload: real length %d exceeds data", r.size)
+	}
+	return r, nil
+}
+
+// Size returns the length of the payload.
+func (r *PayloadReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes of the payload starting at off, as io.ReaderAt
+// does. It returns no data from a chunk that fails authentication, only
+// container.ErrChecksumMismatch and the bytes of the chunks before it.
+func (r *PayloadReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("steg: negative offset %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	// Positions are in the padded payload, where the payload follows its
+	// 4-byte real-length prefix.
+	n := 0
+	end := min(off+int64(len(p)), r.size) + 4
+	for pos := off + 4; pos < end; {
+		i := r.layout.index(pos)
+		from, to := r.layout.bounds(i)
+		data, err := r.chunk(i)
+		if err != nil {
+			return n, err
+		}
+		k := copy(p[n:], data[pos-from:min(to, end)-from])
+		n += k
+		pos += int64(k)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// chunk returns the authenticated data of chunk i, extracting it unless it is
+// the last chunk read.
+func (r *PayloadReader) chunk(i int64) ([]byte, error) {
+	r.mu.Lock()
+	last, lastData := r.last, r.lastData
+	r.mu.Unlock()
+	if i == last {
+		return lastData, nil
+	}
+
+	stack, err := r.newStack()
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.layout.readChunk(stack, r.macKey, i)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.last, r.lastData = i, data
+	r.mu.Unlock()
+	return data, nil
+}
@@ -0,0 +1,127 @@
+package steg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pableeee/steg/cursors"
+	"github.com/pableeee/steg/steg/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkLayout(t *testing.T) {
+	// Stream lengths around chunk boundaries, from 2×2 pixels upwards.
+	for _, side := range []int{2, 10, 60, 61, 62, 100, 105, 106, 300} {
+		m := image.NewRGBA(image.Rect(0, 0, side, side))
+		l := newChunkLayout(m, 1, 3)
+		region := int64(side*side*3/8) - dataStart
+		if region <= 36 {
+			assert.Zero(t, l.chunks, "side %d", side)
+			continue
+		}
+		assert.Equal(t, region, l.streamLen(), "side %d", side)
+		var covered int64
+		for i := range l.chunks {
+			from, to := l.bounds(i)
+			assert.Equal(t, covered, from)
+			assert.Equal(t, i, l.index(from))
+			assert.Equal(t, i, l.index(to-1))
+			assert.Equal(t, dataStart+from+32*i, l.offset(i))
+			assert.Positive(t, to-from)
+			assert.LessOrEqual(t, to-from, int64(chunkDataBytes+32))
+			covered = to
+		}
+		assert.Equal(t, l.paddedLen, covered, "side %d", side)
+	}
+}
+
+func TestPayloadReader(t *testing.T) {
+	pass := []byte("random-access-pass")
+	payload := make([]byte, 15000) // spans four chunks
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	newEncoded := func(t *testing.T) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+		enc, err := NewEncoder(WithRandomAccess())
+		require.NoError(t, err)
+		require.NoError(t, enc.Encode(context.Background(), img, pass, bytes.NewReader(payload)))
+		return img
+	}
+
+	t.Run("should read any range", func(t *testing.T) {
+		pr, err := NewPayloadReader(newEncoded(t), pass)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(payload)), pr.Size())
+		for _, r := range [][2]int{{0, 1}, {4090, 4100}, {100, 12000}, {14999, 15000}, {0, 15000}} {
+			got := make([]byte, r[1]-r[0])
+			n, err := pr.ReadAt(got, int64(r[0]))
+			require.NoError(t, err)
+			assert.Equal(t, len(got), n)
+			assert.Equal(t, payload[r[0]:r[1]], got)
+		}
+		n, err := pr.ReadAt(make([]byte, 10), 14995)
+		assert.Equal(t, 5, n)
+		assert.Equal(t, io.EOF, err)
+		require.NoError(t, iotest.TestReader(io.NewSectionReader(pr, 0, pr.Size()), payload))
+	})
+
+	t.Run("should share the layout with every encode and decode path", func(t *testing.T) {
+		img := newEncoded(t)
+		got, err := Decode(img, pass, 1, 3, WithRandomAccess())
+		require.NoError(t, err)
+		assert.Equal(t, payload, got)
+		_, err = Decode(img, pass, 1, 3)
+		assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+		res, err := Verify(img, pass, 1, 3, WithRandomAccess())
+		require.NoError(t, err)
+		assert.Equal(t, len(payload), res.PayloadSize)
+
+		img = image.NewRGBA(image.Rect(0, 0, 300, 200))
+		w := NewWriter(img, pass, WithRandomAccess())
+		_, err = io.Copy(w, iotest.OneByteReader(bytes.NewReader(payload)))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		got, err = DecodeParallel(img, pass, 1, 3, WithRandomAccess())
+		require.NoError(t, err)
+		assert.Equal(t, payload, got)
+		got, err = io.ReadAll(NewReader(img, pass, WithRandomAccess()))
+		require.NoError(t, err)
+		assert.Equal(t, payload, got)
+	})
+
+	t.Run("should fail only the reads of a modified chunk", func(t *testing.T) {
+		img := newEncoded(t)
+		l := newChunkLayout(img, 1, 3)
+
+		// Flip the R LSB of the pixel holding a data byte in chunk 2.
+		seed, err := deriveSeed(pass)
+		require.NoError(t, err)
+		pt := cursors.GenerateSequence(300, 200, seed)[(l.offset(2)+100)*8/3]
+		c := img.RGBAAt(pt.X, pt.Y)
+		img.SetRGBA(pt.X, pt.Y, color.RGBA{c.R ^ 1, c.G, c.B, c.A})
+
+		pr, err := NewPayloadReader(img, pass)
+		require.NoError(t, err)
+		got := make([]byte, 4000)
+		_, err = pr.ReadAt(got, 0)
+		require.NoError(t, err)
+		assert.Equal(t, payload[:4000], got)
+		_, err = pr.ReadAt(got, 9000)
+		assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+
+		_, err = Verify(img, pass, 1, 3, WithRandomAccess())
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+
+	t.Run("should reject a wrong password", func(t *testing.T) {
+		_, err := NewPayloadReader(newEncoded(t), []byte("wrong pass"))
+		assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+	})
+}
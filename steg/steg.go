@@ -6,18 +6,23 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image/draw"
+	"io"
 
 	"github.com/pableeee/steg/cursors"
 	"golang.org/x/crypto/argon2"
 )
 
 // cursorOptions builds the RNGCursor option slice for the given configuration.
-// channels: 1 = R only, 2 = R+G, 3 = R+G+B.
-func cursorOptions(seed int64, bitsPerChannel, channels int) []cursors.Option {
+// channels: 1 = R only, 2 = R+G, 3 = R+G+B. A nil slotKey keeps the fixed slot
+// order.
+func cursorOptions(tr cursors.Traversal, slotKey []byte, bitsPerChannel, channels int) []cursors.Option {
 	opts := []cursors.Option{
-		cursors.WithSeed(seed),
+		cursors.WithTraversal(tr),
 		cursors.WithBitsPerChannel(bitsPerChannel),
 	}
+	if slotKey != nil {
+		opts = append(opts, cursors.WithSlotKey(slotKey))
+	}
 	if channels >= 2 {
 		opts = append(opts, cursors.UseGreenBit())
 	}
@@ -27,6 +32,10 @@ func cursorOptions(seed int64, bitsPerChannel, channels int) []cursors.Option {
 	return opts
 }
 
+// randReader supplies the per-encode salt and the payload padding. Tests
+// replace it to make encodes reproducible.
+var randReader io.Reader = rand.Reader
+
 func gcd(a, b int) int {
 	for b != 0 {
 		a, b = b, a%b
@@ -60,6 +69,25 @@ func deriveMainKeys(pass, salt []byte) (encKey, macKey []byte, payloadNonce uint
 	return encKey, macKey, payloadNonce, nil
 }
 
+// Argon2id salts of the traversal and slot permutation keys, which depend on
+// the password alone. They cannot be random, since the per-image salt is only
+// found by following the traversal; being fixed and of a different length than
+// the 16-byte random salts, they keep these keys independent of the encryption
+// and MAC keys derived from the same password, and of each other.
+const (
+	chacha8Salt = "steg/traversal/chacha8/v1"
+	feistelSalt = "steg/traversal/feistel/v1"
+	slotSalt    = "steg/slot-permutation/v1"
+)
+
+// deriveTraversalKey stretches pass into a 32-byte traversal key under salt,
+// with the same Argon2id parameters as deriveMainKeys.
+func deriveTraversalKey(pass []byte, salt string) [32]byte {
+	var key [32]byte
+	copy(key[:], argon2.IDKey(pass, []byte(salt), 2, 64*1024, 4, 32))
+	return key
+}
+
 // imageCapacityBytes returns the maximum real payload size for the given image and
 // encoding settings. Overhead is 56 bytes: 16 (plaintext salt) + 4 (container
 // length) + 4 (embedded real-length prefix) + 32 (HMAC-SHA256 tag).
@@ -76,9 +104,9 @@ func imageCapacityBytes(m draw.Image, bitsPerChannel, channels int) int {
 // buildPaddedPayload prepends a 4-byte LE real-length prefix and appends random
 // padding so the full image capacity is always written. This removes the
 // payload-size signal from LSB statistics regardless of actual payload size.
-// The returned slice is passed directly to container.WritePayload.
-func buildPaddedPayload(m draw.Image, payload []byte, bitsPerChannel, channels int) ([]byte, error) {
-	cap := imageCapacityBytes(m, bitsPerChannel, channels)
+// cap is the maximum real payload size of the image. Encoder.Encode
+// embeds the returned slice between the container length and the tag or tags.
+func buildPaddedPayload(payload []byte, cap int) ([]byte, error) {
 	if cap <= 0 {
 		return nil, fmt.Errorf("steg: image too small to hold any payload")
 	}
@@ -90,14 +118,14 @@ func buildPaddedPayload(m draw.Image, payload []byte, bitsPerChannel, channels i
 	out := make([]byte, 4+cap)
 	binary.LittleEndian.PutUint32(out[:4], uint32(len(payload)))
 	copy(out[4:], payload)
-	if _, err := rand.Read(out[4+len(payload):]); err != nil {
+	if _, err := io.ReadFull(randReader, out[4+len(payload):]); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// extractRealPayload recovers the original payload from the padded buffer returned
-// by container.ReadPayload. The first 4 bytes are the LE-encoded real length.
+// extractRealPayload recovers the original payload from the padded buffer read
+// by Decoder.Decode. The first 4 bytes are the LE-encoded real length.
 func extractRealPayload(padded []byte) ([]byte, error) {
 	if len(padded) < 4 {
 		return nil, fmt.Errorf("steg: padded payload too short")
@@ -2,7 +2,10 @@ package steg
 
 import (
 	"bytes"
+	"fmt"
 	"image"
+	mathrand "math/rand"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,3 +71,134 @@ func TestMultiBitRoundTrip(t *testing.T) {
 		require.Error(t, err, "decoding with wrong bitsPerChannel should fail MAC verification")
 	})
 }
+
+func TestChaCha8Traversal(t *testing.T) {
+	pass := []byte("chacha8-pass")
+	payload := []byte("argon2id-keyed traversal")
+	chacha := []Option{WithTraversal(TraversalChaCha8)}
+
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	require.NoError(t, EncodeParallel(img, pass, bytes.NewReader(payload), 2, 3, chacha...))
+	got, err := Decode(img, pass, 2, 3, chacha...)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+	got, err = DecodeParallel(img, pass, 2, 3, chacha...)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	_, err = Decode(img, pass, 2, 3)
+	assert.Error(t, err, "the legacy traversal reads other pixels")
+
+	seq := image.NewRGBA(img.Rect)
+	require.NoError(t, Encode(seq, pass, bytes.NewReader(payload), 1, 3, WithTraversal(TraversalChaCha8)))
+	got, err = Decode(seq, pass, 1, 3, WithTraversal(TraversalChaCha8))
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+func TestSlotPermutation(t *testing.T) {
+	pass := []byte("slot-pass")
+	payload := []byte("scattered slots")
+	permute := WithSlotPermutation()
+
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	require.NoError(t, Encode(img, pass, bytes.NewReader(payload), 2, 3, permute))
+	got, err := Decode(img, pass, 2, 3, permute)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+	_, err = Verify(img, pass, 2, 3, permute)
+	require.NoError(t, err)
+
+	_, err = Verify(img, pass, 2, 3)
+	assert.ErrorIs(t, err, ErrWrongKey, "the fixed slot order reads other bits")
+
+	feistel := []Option{permute, WithTraversal(TraversalFeistel)}
+	par := image.NewRGBA(img.Rect)
+	require.NoError(t, EncodeParallel(par, pass, bytes.NewReader(payload), 3, 2, feistel...))
+	got, err = Decode(par, pass, 3, 2, feistel...)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+// setRandReader replaces randReader with a seeded source for the rest of the
+// test, so that two encodes with the same seed choose the same salt and
+// padding.
+func setRandReader(t *testing.T, seed int64) {
+	old := randReader
+	randReader = mathrand.New(mathrand.NewSource(seed))
+	t.Cleanup(func() { randReader = old })
+}
+
+// TestEncodeParallelMatchesEncode checks that EncodeParallel writes exactly the
+// image Encode does, including pixel sizes that do not divide a byte, with
+// enough workers that chunks are written concurrently. Run it with -race to
+// check that workers never share a pixel.
+func TestEncodeParallelMatchesEncode(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	pass := []byte("parallel-layout")
+	payload := bytes.Repeat([]byte("lock-free "), 500)
+
+	for _, tc := range []struct {
+		bits, channels int
+		permute        bool
+	}{{1, 1, false}, {1, 3, false}, {2, 3, false}, {3, 3, false}, {3, 2, false}, {8, 3, false},
+		{1, 3, true}, {3, 2, true}, {3, 3, true}} {
+		var opts []Option
+		name := fmt.Sprintf("%d bits x %d channels", tc.bits, tc.channels)
+		if tc.permute {
+			opts = append(opts, WithSlotPermutation())
+			name += " permuted"
+		}
+		t.Run(name, func(t *testing.T) {
+			seq := image.NewRGBA(image.Rect(0, 0, 300, 200))
+			mathrand.New(mathrand.NewSource(1)).Read(seq.Pix)
+			par := image.NewRGBA(seq.Rect)
+			copy(par.Pix, seq.Pix)
+
+			setRandReader(t, 2)
+			require.NoError(t, Encode(seq, pass, bytes.NewReader(payload), tc.bits, tc.channels, opts...))
+			setRandReader(t, 2)
+			require.NoError(t, EncodeParallel(par, pass, bytes.NewReader(payload), tc.bits, tc.channels, opts...))
+			require.Equal(t, seq.Pix, par.Pix)
+
+			got, err := DecodeParallel(par, pass, tc.bits, tc.channels, opts...)
+			require.NoError(t, err)
+			assert.Equal(t, payload, got)
+		})
+	}
+}
+
+func TestTraversal(t *testing.T) {
+	pass := []byte("traversal-pass")
+	payload := []byte("constant-memory traversal")
+	feistel := WithTraversal(TraversalFeistel)
+
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	require.NoError(t, Encode(img, pass, bytes.NewReader(payload), 1, 3, feistel))
+	got, err := Decode(img, pass, 1, 3, feistel)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+	got, err = DecodeParallel(img, pass, 1, 3, feistel)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	_, err = Decode(img, pass, 1, 3)
+	assert.Error(t, err, "the default traversal reads other pixels")
+
+	par := image.NewRGBA(img.Rect)
+	require.NoError(t, EncodeParallel(par, pass, bytes.NewReader(payload), 2, 3, feistel))
+	got, err = Decode(par, pass, 2, 3, feistel)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	_, err = Decode(img, pass, 1, 3, WithTraversal(Traversal(99)))
+	assert.Error(t, err)
+
+	for _, tr := range []Traversal{TraversalFisherYates, TraversalFeistel, TraversalChaCha8} {
+		parsed, err := ParseTraversal(tr.String())
+		require.NoError(t, err)
+		assert.Equal(t, tr, parsed)
+	}
+	_, err = ParseTraversal("raster")
+	assert.Error(t, err)
+}
@@ -0,0 +1,300 @@
+package steg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/draw"
+	"io"
+
+	"github.com/pableeee/steg/cursors"
+	"github.com/pableeee/steg/steg/container"
+)
+
+// errWriterClosed is returned by Write and Close once a Writer is closed.
+var errWriterClosed = errors.New("steg: writer is closed")
+
+// writer is the io.WriteCloser returned by NewWriter.
+type writer struct {
+	stack    io.ReadWriteSeeker
+	body     io.Writer // the stack, or a chunkWriter over it in the random-access layout
+	macKey   []byte
+	capacity int64  // bytes of real payload the image can hold
+	lenField uint32 // container length field
+	n        int64  // bytes of real payload written so far
+	err      error  // sticky: set by a failed setup or write, or by Close
+}
+
+// NewWriter returns a writer that embeds the bytes written to it into m, in
+// the layout Encoder.Encode produces. Data is encrypted and embedded as it is
+// written; Close fills the rest of the capacity with random padding, then
+// records the lengths and the tag. Until Close returns nil, m holds no valid
+// payload. Writing past the image capacity fails, and Close then returns the
+// same error.
+//
+// In the random-access layout (WithRandomAccess) each chunk is tagged as soon
+// as it is complete, so Close makes no second pass over the image.
+//
+// The options are those of NewEncoder; the writer always works on the calling
+// goroutine and reports no progress. An invalid option, or a failure deriving
+// the keys, is returned by the first call to Write or Close.
+func NewWriter(m draw.Image, pass []byte, opts ...Option) io.WriteCloser {
+	w := &writer{}
+	w.err = w.open(m, pass, newConfig(opts))
+	return w
+}
+
+func (w *writer) open(m draw.Image, pass []byte, cfg *config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	bpc, channels := cfg.bitsPerChannel, cfg.channels
+	w.capacity = int64(cfg.capacity(m))
+	w.lenField = cfg.containerLen(m)
+	if w.capacity <= 0 {
+		return fmt.Errorf("steg: image too small to hold any payload")
+	}
+	tr, err := cfg.pixelTraversal(m, pass)
+	if err != nil {
+		return err
+	}
+	slotKey := cfg.slotKey(pass)
+
+	// Random per-encode salt in plaintext at bytes 0–15, as in Encoder.Encode.
+	rawCur := cursors.NewRNGCursor(m, cursorOptions(tr, slotKey, bpc, channels)...)
+	var randomSalt [16]byte
+	if _, err = io.ReadFull(randReader, randomSalt[:]); err != nil {
+		return err
+	}
+	if _, err = cursors.CursorAdapter(rawCur).Write(randomSalt[:]); err != nil {
+		return err
+	}
+	rawCur.Flush()
+
+	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
+	if err != nil {
+		return err
+	}
+	w.macKey = macKey
+	w.stack, err = newWorkerStack(m, payloadNonce, encKey, tr, slotKey, bpc, channels)
+	if err != nil {
+		return err
+	}
+	// The real payload starts after its 4-byte length prefix, which is only
+	// known on Close.
+	if cfg.randomAccess {
+		w.body = &chunkWriter{
+			stack:  w.stack,
+			macKey: macKey,
+			layout: newChunkLayout(m, bpc, channels),
+			buf:    make([]byte, 4, chunkDataBytes+32),
+		}
+		return nil
+	}
+	w.body = w.stack
+	_, err = w.stack.Seek(dataStart+4, io.SeekStart)
+	return err
+}
+
+// Write embeds p after the bytes written before it.
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	tooLarge := int64(len(p)) > w.capacity-w.n
+	if tooLarge {
+		p = p[:w.capacity-w.n]
+	}
+	n, err := w.body.Write(p)
+	w.n += int64(n)
+	if err == nil && tooLarge {
+		err = fmt.Errorf("steg: payload too large (capacity %d bytes)", w.capacity)
+	}
+	w.err = err
+	return n, err
+}
+
+// Close pads the payload to the image capacity and writes the real length,
+// the container length and the tag or tags still missing.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errWriterClosed
+
+	if _, err := io.CopyN(w.body, randReader, w.capacity-w.n); err != nil {
+		return err
+	}
+	paddedLen := w.capacity + 4
+	lenBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBuf, w.lenField)
+	if _, err := w.stack.Seek(16, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.stack.Write(lenBuf); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(lenBuf, uint32(w.n))
+	if cw, ok := w.body.(*chunkWriter); ok {
+		copy(cw.head, lenBuf)
+		return cw.layout.writeChunk(w.stack, w.macKey, 0, cw.head)
+	}
+	if _, err := w.stack.Seek(dataStart, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.stack.Write(lenBuf); err != nil {
+		return err
+	}
+
+	// The tag covers the real-length prefix, which was written last, so the
+	// padded block is read back from the image to compute it.
+	mac := hmac.New(sha256.New, w.macKey)
+	if _, err := w.stack.Seek(dataStart, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(mac, w.stack, paddedLen); err != nil {
+		return err
+	}
+	_, err := w.stack.Write(mac.Sum(nil))
+	return err
+}
+
+// chunkWriter embeds the padded payload in the random-access layout, tagging
+// each chunk once it is complete. Chunk 0 is held back because it starts with
+// the real-length prefix, which is only known on Close.
+type chunkWriter struct {
+	stack  io.WriteSeeker
+	macKey []byte
+	layout chunkLayout
+	next   int64  // index of the chunk being filled
+	buf    []byte // bytes of chunk next written so far
+	head   []byte // chunk 0, once complete
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		from, to := cw.layout.bounds(cw.next)
+		k := min(len(p)-n, int(to-from)-len(cw.buf))
+		cw.buf = append(cw.buf, p[n:n+k]...)
+		n += k
+		if int64(len(cw.buf)) < to-from {
+			break
+		}
+		if cw.next == 0 {
+			cw.head = cw.buf
+			cw.buf = make([]byte, 0, chunkDataBytes+32)
+		} else {
+			if err := cw.layout.writeChunk(cw.stack, cw.macKey, cw.next, cw.buf); err != nil {
+				return n, err
+			}
+			cw.buf = cw.buf[:0]
+		}
+		cw.next++
+	}
+	return n, nil
+}
+
+// reader is the io.Reader returned by NewReader.
+type reader struct {
+	r   io.Reader
+	err error
+}
+
+// NewReader returns a reader of the payload embedded in m. Before yielding
+// any data it reads the whole padded payload once to check the tag, hashing
+// and discarding it, so memory use does not grow with the payload; then it
+// reads the real payload a second time as it is consumed. In the random-access
+// layout (WithRandomAccess) it makes a single pass instead, checking each
+// chunk before yielding it. m must not change while it is read.
+//
+// The options are those of NewDecoder; the reader always works on the calling
+// goroutine and reports no progress. A wrong password or mismatched option
+// fails the first Read, most often with container.ErrChecksumMismatch.
+func NewReader(m draw.Image, pass []byte, opts ...Option) io.Reader {
+	rd := &reader{}
+	rd.r, rd.err = openPayload(m, pass, newConfig(opts))
+	return rd
+}
+
+func (rd *reader) Read(p []byte) (int, error) {
+	if rd.err != nil {
+		return 0, rd.err
+	}
+	return rd.r.Read(p)
+}
+
+// openPayload authenticates the payload embedded in m and returns a reader of
+// the real payload.
+func openPayload(m draw.Image, pass []byte, cfg *config) (io.Reader, error) {
+	if cfg.randomAccess {
+		pr, err := openPayloadReader(m, pass, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(pr, 0, pr.Size()), nil
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	bpc, channels := cfg.bitsPerChannel, cfg.channels
+	tr, err := cfg.pixelTraversal(m, pass)
+	if err != nil {
+		return nil, err
+	}
+	slotKey := cfg.slotKey(pass)
+
+	// Read the 16-byte random salt from image bytes 0–15 (stored in plaintext).
+	rawCur := cursors.NewRNGCursor(m, cursorOptions(tr, slotKey, bpc, channels)...)
+	var randomSalt [16]byte
+	if _, err = io.ReadFull(cursors.CursorAdapter(rawCur), randomSalt[:]); err != nil {
+		return nil, err
+	}
+	encKey, macKey, payloadNonce, err := deriveMainKeys(pass, randomSalt[:])
+	if err != nil {
+		return nil, err
+	}
+	stack, err := newWorkerStack(m, payloadNonce, encKey, tr, slotKey, bpc, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject a wrong container length before streaming, as Decoder.Decode
+	// does.
+	if err = cfg.checkContainerLen(stack, m); err != nil {
+		return nil, err
+	}
+	paddedLen := int64(imageCapacityBytes(m, bpc, channels)) + 4
+
+	if _, err = stack.Seek(16, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sink := &realLengthSink{}
+	if _, err = container.ReadPayloadTo(stack, sink, hmac.New(sha256.New, macKey)); err != nil {
+		return nil, err
+	}
+	realLen := int64(binary.LittleEndian.Uint32(sink.prefix[:]))
+	if realLen > paddedLen-4 {
+		return nil, fmt.Errorf("steg: corrupt payload: real length %d exceeds data", realLen)
+	}
+	if _, err = stack.Seek(dataStart+4, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(stack, realLen), nil
+}
+
+// realLengthSink keeps the 4-byte real-length prefix of the padded payload and
+// discards everything after it.
+type realLengthSink struct {
+	prefix [4]byte
+	n      int
+}
+
+func (s *realLengthSink) Write(p []byte) (int, error) {
+	if s.n < len(s.prefix) {
+		s.n += copy(s.prefix[s.n:], p)
+	}
+	return len(p), nil
+}
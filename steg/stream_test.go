@@ -0,0 +1,103 @@
+package steg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/pableeee/steg/cursors"
+	"github.com/pableeee/steg/steg/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterReader(t *testing.T) {
+	pass := []byte("stream-pass")
+	payload := bytes.Repeat([]byte("streamed through gzip "), 200)
+
+	t.Run("should round trip through gzip", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+		w := NewWriter(img, pass, WithBitsPerChannel(2), WithSlotPermutation())
+		zw := gzip.NewWriter(w)
+		_, err := zw.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		require.NoError(t, w.Close())
+		assert.ErrorIs(t, w.Close(), errWriterClosed)
+
+		zr, err := gzip.NewReader(NewReader(img, pass, WithBitsPerChannel(2), WithSlotPermutation()))
+		require.NoError(t, err)
+		got, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, payload, got)
+	})
+
+	t.Run("should share the layout of Encoder and Decoder", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		w := NewWriter(img, pass, WithTraversal(TraversalFeistel))
+		_, err := io.Copy(w, bytes.NewReader(payload[:500]))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		got, err := Decode(img, pass, 1, 3, WithTraversal(TraversalFeistel))
+		require.NoError(t, err)
+		assert.Equal(t, payload[:500], got)
+
+		require.NoError(t, Encode(img, pass, bytes.NewReader(payload[:300]), 1, 3))
+		got, err = io.ReadAll(NewReader(img, pass))
+		require.NoError(t, err)
+		assert.Equal(t, payload[:300], got)
+	})
+
+	t.Run("should embed an empty payload", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		require.NoError(t, NewWriter(img, pass).Close())
+		got, err := io.ReadAll(NewReader(img, pass))
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("should fail past the capacity", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		capacity := imageCapacityBytes(img, 1, 3)
+		w := NewWriter(img, pass)
+		n, err := w.Write(make([]byte, capacity+1))
+		assert.Equal(t, capacity, n)
+		assert.EqualError(t, err, "steg: payload too large (capacity 1819 bytes)")
+		assert.Equal(t, err, w.Close())
+	})
+
+	t.Run("should report setup errors on first use", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		_, err := NewWriter(img, pass, WithChannels(4)).Write([]byte("x"))
+		assert.EqualError(t, err, "steg: channels must be between 1 and 3, got 4")
+		_, err = NewReader(img, pass, WithWorkers(-1)).Read(make([]byte, 1))
+		assert.EqualError(t, err, "steg: workers must not be negative, got -1")
+	})
+
+	t.Run("should yield no data for a wrong password or a modified payload", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		enc, err := NewEncoder(WithWorkers(1))
+		require.NoError(t, err)
+		require.NoError(t, enc.Encode(context.Background(), img, pass, bytes.NewReader(payload[:100])))
+
+		got, err := io.ReadAll(NewReader(img, []byte("wrong pass")))
+		assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+		assert.Empty(t, got)
+
+		// Flip the R LSB of the 1000th pixel in traversal order, inside the
+		// padding: the real payload is intact but must not be returned.
+		seed, err := deriveSeed(pass)
+		require.NoError(t, err)
+		pt := cursors.GenerateSequence(100, 50, seed)[1000]
+		c := img.RGBAAt(pt.X, pt.Y)
+		img.SetRGBA(pt.X, pt.Y, color.RGBA{c.R ^ 1, c.G, c.B, c.A})
+
+		got, err = io.ReadAll(NewReader(img, pass))
+		assert.ErrorIs(t, err, container.ErrChecksumMismatch)
+		assert.Empty(t, got)
+	})
+}
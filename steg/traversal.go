@@ -0,0 +1,91 @@
+package steg
+
+import (
+	"fmt"
+	"image/draw"
+
+	"github.com/pableeee/steg/cursors"
+)
+
+// Traversal selects the order in which pixels carry the payload. It is not
+// recorded in the image: decoding must use the traversal the image was encoded
+// with, like the bits-per-channel and channel settings.
+type Traversal int
+
+const (
+	// TraversalFisherYates shuffles a list of every pixel with a generator
+	// seeded from the password. It is the original traversal and the default.
+	// The list costs 16 bytes per pixel and is built before any data is
+	// written. Its seed is an unstretched SHA-256 of the password, reduced by
+	// math/rand to one of about two billion orders; prefer TraversalChaCha8
+	// for new images.
+	TraversalFisherYates Traversal = iota
+	// TraversalFeistel computes each pixel of the order on demand with a keyed
+	// Feistel permutation (see cursors.FeistelTraversal), in constant memory.
+	// Its key is derived like that of TraversalChaCha8, under a salt of its
+	// own. Prefer it for very large images.
+	TraversalFeistel
+	// TraversalChaCha8 shuffles the pixels like TraversalFisherYates, but with
+	// a ChaCha8 stream keyed by 256 bits that Argon2id derives from the
+	// password under a salt of its own (see cursors.ShuffleChaCha8). Guessing
+	// the order costs as much as guessing the password. The key derivation
+	// adds one Argon2id run per operation.
+	TraversalChaCha8
+)
+
+var traversalNames = map[Traversal]string{
+	TraversalFisherYates: "fisher-yates",
+	TraversalFeistel:     "feistel",
+	TraversalChaCha8:     "chacha8",
+}
+
+// String returns the name ParseTraversal accepts for t.
+func (t Traversal) String() string {
+	if name, ok := traversalNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Traversal(%d)", int(t))
+}
+
+// ParseTraversal returns the traversal named s: "fisher-yates", "feistel" or
+// "chacha8".
+func ParseTraversal(s string) (Traversal, error) {
+	for t, name := range traversalNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown traversal %q", s)
+}
+
+// slotKey returns the key of the per-pixel slot permutation for pass, or nil
+// when WithSlotPermutation is not set. Like the traversal keys, it depends on
+// the password alone, since it already applies to the pixels holding the salt,
+// and is derived with Argon2id under a salt of its own.
+func (c *config) slotKey(pass []byte) []byte {
+	if !c.permuteSlots {
+		return nil
+	}
+	key := deriveTraversalKey(pass, slotSalt)
+	return key[:]
+}
+
+// pixelTraversal returns the pixel order of m for pass under the configured
+// traversal. It fails on an empty password.
+func (c *config) pixelTraversal(m draw.Image, pass []byte) (cursors.Traversal, error) {
+	seed, err := deriveSeed(pass)
+	if err != nil {
+		return nil, err
+	}
+	b := m.Bounds()
+	switch c.traversal {
+	case TraversalFisherYates:
+		return cursors.Points(cursors.GenerateSequence(b.Max.X, b.Max.Y, seed)), nil
+	case TraversalFeistel:
+		key := deriveTraversalKey(pass, feistelSalt)
+		return cursors.NewFeistelTraversal(b.Max.X, b.Max.Y, key[:]), nil
+	case TraversalChaCha8:
+		return cursors.ShuffleChaCha8(b.Max.X, b.Max.Y, deriveTraversalKey(pass, chacha8Salt)), nil
+	}
+	return nil, fmt.Errorf("steg: unknown traversal %v", c.traversal)
+}
@@ -0,0 +1,69 @@
+package steg
+
+import (
+	"errors"
+	"fmt"
+	"image/draw"
+	"io"
+	"slices"
+
+	"github.com/pableeee/steg/steg/container"
+)
+
+var (
+	// ErrWrongKey is returned by Verify when the header does not decrypt to a
+	// valid length: the password or an encoding option differs from the ones
+	// used to encode, the image carries no payload at all, or the header
+	// pixels themselves were modified.
+	ErrWrongKey = errors.New("steg: wrong password or encoding parameters")
+
+	// ErrCorrupt is returned by Verify when the header decrypts correctly but
+	// the payload fails HMAC verification, i.e. the image was modified.
+	ErrCorrupt = errors.New("steg: payload corrupted")
+)
+
+// VerifyResult describes a payload that passed authentication.
+type VerifyResult struct {
+	PayloadSize    int // bytes of real payload
+	Capacity       int // maximum payload size for these settings
+	BitsPerChannel int
+	Channels       int
+}
+
+// Verify runs the streaming decode path of NewReader, including the HMAC
+// check, and discards the plaintext as it is read, so memory use does not grow
+// with the payload.
+//
+// Because every encode fills the image to capacity, a correct key always
+// decrypts the container length to the one the settings give m. Any other
+// value means the key or settings are wrong (ErrWrongKey); a matching length
+// followed by a tag mismatch means the payload was altered (ErrCorrupt). The
+// salt and the container length carry no tag of their own, so a change to
+// them cannot be told from a wrong key and is also ErrWrongKey. In the
+// random-access layout (WithRandomAccess) the chunks holding the payload are
+// authenticated one at a time.
+func Verify(m draw.Image, pass []byte, bitsPerChannel, channels int, opts ...Option) (VerifyResult, error) {
+	cfg := newConfig(slices.Concat(opts, []Option{WithBitsPerChannel(bitsPerChannel), WithChannels(channels)}))
+	res := VerifyResult{
+		Capacity:       cfg.capacity(m),
+		BitsPerChannel: bitsPerChannel,
+		Channels:       channels,
+	}
+	if res.Capacity <= 0 {
+		return res, fmt.Errorf("steg: image too small to hold any payload")
+	}
+
+	r, err := openPayload(m, pass, cfg)
+	if err == nil {
+		var n int64
+		n, err = io.Copy(io.Discard, r)
+		res.PayloadSize = int(n)
+	}
+	switch {
+	case errors.Is(err, errContainerLength):
+		return res, ErrWrongKey
+	case errors.Is(err, container.ErrChecksumMismatch):
+		return res, ErrCorrupt
+	}
+	return res, err
+}
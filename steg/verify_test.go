@@ -0,0 +1,94 @@
+package steg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/pableeee/steg/cursors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	pass := []byte("verify-pass")
+	payload := []byte("payload to verify")
+
+	newEncoded := func(t *testing.T) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		require.NoError(t, Encode(img, pass, bytes.NewReader(payload), 1, 3))
+		return img
+	}
+
+	t.Run("should report the payload size of an intact image", func(t *testing.T) {
+		res, err := Verify(newEncoded(t), pass, 1, 3)
+		require.NoError(t, err)
+		assert.Equal(t, len(payload), res.PayloadSize)
+		assert.Equal(t, imageCapacityBytes(image.NewRGBA(image.Rect(0, 0, 100, 50)), 1, 3), res.Capacity)
+	})
+
+	t.Run("should report a wrong password as ErrWrongKey", func(t *testing.T) {
+		_, err := Verify(newEncoded(t), []byte("wrong pass"), 1, 3)
+		assert.ErrorIs(t, err, ErrWrongKey)
+	})
+
+	t.Run("should report wrong encoding parameters as ErrWrongKey", func(t *testing.T) {
+		_, err := Verify(newEncoded(t), pass, 2, 3)
+		assert.ErrorIs(t, err, ErrWrongKey)
+	})
+
+	t.Run("should report a modified payload as ErrCorrupt", func(t *testing.T) {
+		img := newEncoded(t)
+
+		// Flip the R LSB of the 1000th pixel in traversal order: bits 3000–3002,
+		// past the 160-bit salt and length header and before the tag.
+		seed, err := deriveSeed(pass)
+		require.NoError(t, err)
+		pt := cursors.GenerateSequence(100, 50, seed)[1000]
+		c := img.RGBAAt(pt.X, pt.Y)
+		img.SetRGBA(pt.X, pt.Y, color.RGBA{c.R ^ 1, c.G, c.B, c.A})
+
+		_, err = Verify(img, pass, 1, 3)
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+
+	t.Run("should report a modified header as ErrWrongKey", func(t *testing.T) {
+		img := newEncoded(t)
+
+		// Flip the R LSB of the 45th pixel: bits 135–137, inside the 32-bit
+		// container length at bits 128–159.
+		seed, err := deriveSeed(pass)
+		require.NoError(t, err)
+		pt := cursors.GenerateSequence(100, 50, seed)[45]
+		c := img.RGBAAt(pt.X, pt.Y)
+		img.SetRGBA(pt.X, pt.Y, color.RGBA{c.R ^ 1, c.G, c.B, c.A})
+
+		_, err = Verify(img, pass, 1, 3)
+		assert.ErrorIs(t, err, ErrWrongKey)
+	})
+
+	t.Run("should report a layout mismatch in one chunk as ErrWrongKey", func(t *testing.T) {
+		// The whole payload region of a 100×100 image at 1 bit per channel
+		// fits in one chunk, so both layouts have the same padded length.
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		require.EqualValues(t, 1, newChunkLayout(img, 1, 3).chunks)
+
+		require.NoError(t, Encode(img, pass, bytes.NewReader(payload), 1, 3))
+		_, err := Verify(img, pass, 1, 3, WithRandomAccess())
+		assert.ErrorIs(t, err, ErrWrongKey)
+
+		require.NoError(t, Encode(img, pass, bytes.NewReader(payload), 1, 3, WithRandomAccess()))
+		_, err = Verify(img, pass, 1, 3)
+		assert.ErrorIs(t, err, ErrWrongKey)
+
+		// A modified one-chunk payload is still ErrCorrupt.
+		seed, err := deriveSeed(pass)
+		require.NoError(t, err)
+		pt := cursors.GenerateSequence(100, 100, seed)[1000]
+		c := img.RGBAAt(pt.X, pt.Y)
+		img.SetRGBA(pt.X, pt.Y, color.RGBA{c.R ^ 1, c.G, c.B, c.A})
+		_, err = Verify(img, pass, 1, 3, WithRandomAccess())
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+}